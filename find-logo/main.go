@@ -0,0 +1,233 @@
+// Command find-logo reports images that likely contain a given template
+// image, like a logo, somewhere inside them.
+//
+// Usage:
+//
+//	find-logo [flags] template.png dir
+//
+// Each image found in dir is searched with a sliding window of template
+// aspect ratio, at several window sizes; window contents are hashed and
+// compared against template hash. Images where the closest window is within
+// threshold are reported, along with window position. Templates with little
+// detail, like smooth gradients, hash similar to many unrelated regions, so
+// expect false positives with them.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar"
+	"github.com/disintegration/imaging"
+)
+
+func main() {
+	log.SetFlags(0)
+	args := runArgs{threshold: similar.DefaultThreshold, minScale: 0.1}
+	flag.IntVar(&args.threshold, "threshold", args.threshold, "phash distance threshold (0..64)")
+	flag.Float64Var(&args.minScale, "min-scale", args.minScale,
+		"smallest window size to try, as a fraction of image size (0..1]")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: find-logo [flags] template.png dir")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	args.template, args.dir = flag.Arg(0), flag.Arg(1)
+	if err := run(args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type runArgs struct {
+	template  string
+	dir       string
+	threshold int
+	minScale  float64
+}
+
+// hashSize is the side of square image phash works with
+const hashSize = 32
+
+func run(args runArgs) error {
+	if args.threshold < 0 || args.threshold > 64 {
+		return errors.New("-threshold must be in 0..64 range")
+	}
+	if args.minScale <= 0 || args.minScale > 1 {
+		return errors.New("-min-scale must be in (0..1] range")
+	}
+	tpl, err := imaging.Open(args.template, imaging.AutoOrientation(true))
+	if err != nil {
+		return err
+	}
+	tplHash, err := similar.HashImage(tpl)
+	if err != nil {
+		return err
+	}
+	aspect := float64(tpl.Bounds().Dx()) / float64(tpl.Bounds().Dy())
+
+	names := make(chan string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex // serializes output
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				m, err := search(name, tplHash, aspect, args.minScale)
+				mu.Lock()
+				switch {
+				case err != nil:
+					log.Printf("%s: %v", name, err)
+				case m.dist <= args.threshold:
+					fmt.Printf("%q contains template at %d,%d,%d,%d (dist=%d)\n", name,
+						m.rect.Min.X, m.rect.Min.Y, m.rect.Dx(), m.rect.Dy(), m.dist)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	err = filepath.Walk(args.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && similar.IsImage(p) {
+			names <- p
+		}
+		return nil
+	})
+	close(names)
+	wg.Wait()
+	return err
+}
+
+type match struct {
+	rect image.Rectangle // window position in image coordinates
+	dist int
+}
+
+// search finds window of given aspect ratio in named image which hash is the
+// closest to hash. Window sizes range from the largest fitting into image down
+// to minScale of that, each next one 3/4 of the previous; windows are moved by
+// a quarter of their size.
+func search(name string, hash uint64, aspect, minScale float64) (match, error) {
+	img, err := imaging.Open(name, imaging.AutoOrientation(true))
+	if err != nil {
+		return match{}, err
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	// largest window of template aspect ratio fitting into image
+	ww, wh := float64(w), float64(w)/aspect
+	if wh > float64(h) {
+		ww, wh = float64(h)*aspect, float64(h)
+	}
+	best := match{dist: 65}
+	for scale := 1.0; scale >= minScale && ww*scale >= hashSize/2 && wh*scale >= hashSize/2; scale *= 0.75 {
+		// resize image so that window becomes hashSize×hashSize
+		fx, fy := hashSize/(ww*scale), hashSize/(wh*scale)
+		rw, rh := int(float64(w)*fx+0.5), int(float64(h)*fy+0.5)
+		if rw < hashSize || rh < hashSize {
+			continue
+		}
+		small := image.NewGray(image.Rect(0, 0, rw, rh))
+		draw.Draw(small, small.Rect, imaging.Resize(img, rw, rh, imaging.Lanczos), image.Point{}, draw.Src)
+		const stride = hashSize / 4
+		for y := 0; ; y += stride {
+			if y+hashSize > rh {
+				y = rh - hashSize // last row aligned to the bottom edge
+			}
+			for x := 0; ; x += stride {
+				if x+hashSize > rw {
+					x = rw - hashSize
+				}
+				if d := phash.Distance(windowHash(small, x, y), hash); d < best.dist {
+					r := image.Rect(int(float64(x)/fx), int(float64(y)/fy),
+						int(float64(x+hashSize)/fx), int(float64(y+hashSize)/fy))
+					best = match{rect: r, dist: d}
+				}
+				if x+hashSize >= rw {
+					break
+				}
+			}
+			if y+hashSize >= rh {
+				break
+			}
+		}
+	}
+	if best.dist > 64 {
+		return best, errors.New("image is too small to search")
+	}
+	return best, nil
+}
+
+// cosines[u][i] is the DCT-II basis value for frequency u at sample i,
+// including its orthonormal scale factor
+var cosines [8][hashSize]float64
+
+func init() {
+	for u := range cosines {
+		scale := math.Sqrt(2.0 / hashSize)
+		if u == 0 {
+			scale = 1 / math.Sqrt(hashSize)
+		}
+		for i := range cosines[u] {
+			cosines[u][i] = scale * math.Cos(float64((2*i+1)*u)*math.Pi/(2*hashSize))
+		}
+	}
+}
+
+// windowHash returns the same hash phash.Get does for hashSize×hashSize
+// window of img with top left corner at x, y. Unlike phash.Get, which
+// computes all 32×32 DCT coefficients directly, it only computes the 8×8
+// coefficients used in hash, and does it separably, which is orders of
+// magnitude faster: find-logo hashes thousands of windows per image.
+func windowHash(img *image.Gray, x, y int) uint64 {
+	// rows[u][j]: 1D DCT along x of each window row j, for frequencies
+	// u < 8
+	var rows [8][hashSize]float64
+	for j := 0; j < hashSize; j++ {
+		row := img.Pix[(y+j)*img.Stride+x:]
+		for u := range rows {
+			var sum float64
+			for i, c := range cosines[u] {
+				sum += float64(uint32(row[i])*0x101) * c
+			}
+			rows[u][j] = sum
+		}
+	}
+	var dct [8][8]float64
+	var total float64
+	for u := range dct {
+		for v := range dct[u] {
+			var sum float64
+			for j, c := range cosines[v] {
+				sum += rows[u][j] * c
+			}
+			dct[u][v] = sum
+			total += sum
+		}
+	}
+	mean := (total - dct[0][0]) / 63
+	var hash uint64
+	for u := range dct {
+		for v := range dct[u] {
+			if dct[u][v] > mean {
+				hash |= 1 << uint(63-(8*u+v))
+			}
+		}
+	}
+	return hash
+}
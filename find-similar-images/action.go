@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar"
+)
+
+// undoRecord is a line of -manifest file, describing a single action taken
+// on a duplicate
+type undoRecord struct {
+	Action  string `json:"action"`             // move, hardlink, delete or rename-canonical
+	Path    string `json:"path"`               // duplicate file, or the renamed best copy
+	Kept    string `json:"kept"`               // best copy of the group
+	MovedTo string `json:"moved_to,omitempty"` // quarantine path for moves, new name for renames
+}
+
+// applyAction keeps the best image of each group, the first one of
+// sortedGroups, and moves other group members to -quarantine directory,
+// replaces them with hard links to the best image, or deletes them, as
+// -action says. As groups may chain images that are not similar to each
+// other, only members within threshold distance of the best image are
+// touched. With -decisions, planned actions are written to a file instead,
+// see writeDecisions.
+//
+// With -action=rename-canonical, duplicates are left alone, and the best
+// image of each group is renamed in its directory according to
+// -rename-scheme, see canonicalName.
+func applyAction(groups *similar.Groups, args runArgs) error {
+	var recs []undoRecord
+	var decisions []decision
+	var failed int
+	planned := make(map[string]bool) // new names of renamed files
+	for _, ms := range sortedGroups(groups) {
+		best := ms[0]
+		kept := best.Name
+		kfi, err := os.Lstat(kept)
+		if err != nil || !kfi.Mode().IsRegular() {
+			log.Printf("skipping group of %q: not a regular file", kept)
+			continue
+		}
+		if args.action == "rename-canonical" {
+			dst := filepath.Join(filepath.Dir(kept), canonicalName(args.renameScheme, kept, best.Hash, kfi.ModTime()))
+			if dst == kept {
+				continue // renamed by an earlier run
+			}
+			if planned[dst] {
+				log.Printf("skipping %q: another image is renamed to %q", kept, dst)
+				failed++
+				continue
+			}
+			planned[dst] = true
+			recs = append(recs, undoRecord{Action: args.action, Path: kept, Kept: kept, MovedTo: dst})
+			continue
+		}
+		keptRel, keptOK := relPath(args.dir, kept)
+		for _, m := range ms[1:] {
+			if phash.Distance(m.Hash, best.Hash) > args.threshold {
+				continue
+			}
+			if fi, err := os.Lstat(m.Name); args.action == "hardlink" && err == nil && os.SameFile(fi, kfi) {
+				continue // linked by an earlier run
+			}
+			rel, ok := relPath(args.dir, m.Name)
+			if !ok && (args.action == "move" || args.decisions != "") || !keptOK && args.decisions != "" {
+				log.Printf("skipping %q: not inside %q", m.Name, args.dir)
+				failed++
+				continue
+			}
+			rec := undoRecord{Action: args.action, Path: m.Name, Kept: kept}
+			if args.action == "move" {
+				rec.MovedTo = filepath.Join(args.quarantine, rel)
+			}
+			recs = append(recs, rec)
+			decisions = append(decisions, decision{Action: args.action,
+				Path: filepath.ToSlash(rel), Hash: fmt.Sprintf("%016x", m.Hash),
+				Kept: filepath.ToSlash(keptRel), KeptHash: fmt.Sprintf("%016x", best.Hash),
+				Hashing: cacheBucket(args.algo(), args.luma, args.normalize, args.watermark, args.scaledDecode)})
+		}
+	}
+	if args.decisions != "" {
+		if err := writeDecisions(args.decisions, decisions); err != nil {
+			return err
+		}
+	} else if err := perform(recs, args.manifest, args.dryRun); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d duplicates could not be processed", failed)
+	}
+	return nil
+}
+
+// canonicalName returns new base name for named file according to scheme,
+// where {date} is replaced with date of file modification time, {hash} with
+// image hash, {name} with original file name without extension, and {ext}
+// with original extension in lower case.
+func canonicalName(scheme, name string, hash uint64, mtime time.Time) string {
+	base := filepath.Base(name)
+	ext := filepath.Ext(base)
+	return strings.NewReplacer(
+		"{date}", mtime.Format("2006-01-02"),
+		"{hash}", fmt.Sprintf("%016x", hash),
+		"{name}", strings.TrimSuffix(base, ext),
+		"{ext}", strings.ToLower(ext),
+	).Replace(scheme)
+}
+
+// relPath returns name relative to dir, and false if it's not inside dir
+func relPath(dir, name string) (string, bool) {
+	rel, err := filepath.Rel(dir, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// perform applies actions, appending every action taken to manifest file,
+// so it can be reverted by "undo" subcommand later, as far as possible. With
+// dryRun, only reports what would be done. Files that fail to be processed
+// are reported and skipped, and an error is returned at the end.
+func perform(recs []undoRecord, manifest string, dryRun bool) error {
+	if dryRun {
+		for _, rec := range recs {
+			reportStatus("dry run: %s", rec)
+		}
+		return nil
+	}
+	f, err := os.OpenFile(manifest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	undo := json.NewEncoder(f)
+	var failed int
+	for _, rec := range recs {
+		if err := rec.apply(); err != nil {
+			log.Print(err)
+			failed++
+			continue
+		}
+		if err := undo.Encode(rec); err != nil {
+			return fmt.Errorf("writing %s: %w", manifest, err)
+		}
+		reportStatus("%s", rec)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d actions failed", failed, len(recs))
+	}
+	return f.Close()
+}
+
+func (r undoRecord) String() string {
+	switch r.Action {
+	case "move":
+		return fmt.Sprintf("move %q to %q, keeping %q", r.Path, r.MovedTo, r.Kept)
+	case "hardlink":
+		return fmt.Sprintf("replace %q with hard link to %q", r.Path, r.Kept)
+	case "rename-canonical":
+		return fmt.Sprintf("rename %q to %q", r.Path, r.MovedTo)
+	}
+	return fmt.Sprintf("delete %q, keeping %q", r.Path, r.Kept)
+}
+
+// apply performs action on a duplicate
+func (r undoRecord) apply() error {
+	fi, err := os.Lstat(r.Path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s: not a regular file", r.Path)
+	}
+	switch r.Action {
+	case "move", "rename-canonical":
+		return moveFile(r.Path, r.MovedTo)
+	case "hardlink":
+		// link under a temporary name first, so that the duplicate is
+		// replaced atomically, and left intact on errors
+		tmp := filepath.Join(filepath.Dir(r.Path), fmt.Sprintf(".%s.%d.tmp", filepath.Base(r.Path), os.Getpid()))
+		if err := os.Link(r.Kept, tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, r.Path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	case "delete":
+		return os.Remove(r.Path)
+	}
+	return fmt.Errorf("unsupported action %q", r.Action)
+}
+
+// moveFile renames src to dst, creating dst directory if needed, and copying
+// file if they are on different file systems. It never overwrites dst.
+func moveFile(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s: already exists", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies src to a new file dst, preserving its permissions and
+// modification time
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+// undo implements "undo" subcommand: it reverts actions recorded in a
+// -manifest file, latest first. Moved and renamed files are moved back, but
+// deleted files and files replaced with hard links can't be restored, so
+// they are only reported.
+func undo(argv []string) error {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: find-similar-images undo manifest.jsonl")
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var recs []undoRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var r undoRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return fmt.Errorf("%s: %w", fs.Arg(0), err)
+		}
+		recs = append(recs, r)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	var failed int
+	for i := len(recs) - 1; i >= 0; i-- {
+		r := recs[i]
+		if r.Action != "move" && r.Action != "rename-canonical" {
+			log.Printf("can't restore %q: %s, it was similar to %q", r.Path, actionDone(r.Action), r.Kept)
+			failed++
+			continue
+		}
+		if err := moveFile(r.MovedTo, r.Path); err != nil {
+			log.Print(err)
+			failed++
+			continue
+		}
+		log.Printf("moved %q back to %q", r.MovedTo, r.Path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be restored", failed, len(recs))
+	}
+	return nil
+}
+
+func actionDone(action string) string {
+	if action == "hardlink" {
+		return "replaced with hard link"
+	}
+	return "deleted"
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// compareAgainst indexes images of archive directory, then scans dir and
+// reports only its images similar to some image in archive. If one directory
+// is inside the other, images are not matched against themselves.
+func compareAgainst(archive, dir string, opts []similar.Option) error {
+	idx := similar.NewIndex()
+	s := similar.NewScanner(append(opts, similar.WithIndex(idx))...)
+	if err := s.Scan(context.Background(), archive, func(similar.Pair) {}); err != nil {
+		return err
+	}
+	s = similar.NewScanner(append(opts, similar.WithIndex(checkIndex{Index: idx}))...)
+	return s.Scan(context.Background(), dir, func(p similar.Pair) {
+		if sameFile(p.Name, p.Match.Name) {
+			return
+		}
+		if structuredFormat() {
+			writeRecord(newRecord(p.Entry, p.Match.Entry, p.Match.Distance, 0))
+			return
+		}
+		reportFinding(p.Name, "already in archive: %s has phash close (%x, dist=%d) to %s",
+			describe(p.Entry), p.Hash, p.Match.Distance, describe(p.Match.Entry))
+	})
+}
+
+// sameFile reports whether two names refer to the same path
+func sameFile(a, b string) bool {
+	a, err1 := filepath.Abs(a)
+	b, err2 := filepath.Abs(b)
+	return err1 == nil && err2 == nil && a == b
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// algorithms is a flag.Value holding a comma separated list of hash
+// algorithms
+type algorithms []similar.Algorithm
+
+func (a *algorithms) String() string {
+	names := make([]string, len(*a))
+	for i, v := range *a {
+		names[i] = v.String()
+	}
+	return strings.Join(names, ",")
+}
+
+func (a *algorithms) Set(s string) error {
+	var out algorithms
+	seen := make(map[similar.Algorithm]bool)
+	for _, name := range strings.Split(s, ",") {
+		v, err := similar.ParseAlgorithm(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		if seen[v] {
+			return fmt.Errorf("%v is listed twice", v)
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	*a = out
+	return nil
+}
+
+// reportCombined hashes images under dir, found as scan would find them,
+// with each of algos, and reports pairs of images that are within threshold
+// distance by at least minAlgos algorithms. Images that fail to hash are
+// passed to onError if it's set, otherwise the first such error is
+// returned; images over -max-pixels limit are then skipped.
+func reportCombined(dir string, algos algorithms, minAlgos, threshold int, onError func(string, error), opts []similar.Option) error {
+	if minAlgos < 1 || minAlgos > len(algos) {
+		return errors.New("-min-algos must be between 1 and the number of -algo algorithms")
+	}
+	if onError != nil {
+		opts = append(opts, similar.WithErrorHandler(onError))
+	}
+	ctx := context.Background()
+	var names []string
+	err := similar.Walk(ctx, dir, func(p string, _ os.FileInfo) error {
+		names = append(names, p)
+		return nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	hashes := make([][]uint64, len(names)) // per image, per algorithm
+	for i := range hashes {
+		hashes[i] = make([]uint64, len(algos))
+	}
+	failed := make([]bool, len(names))
+	for j, a := range algos {
+		// full slice expression so that opts backing array is not shared
+		results, err := similar.HashAll(ctx, names, append(opts[:len(opts):len(opts)], similar.WithAlgorithm(a))...)
+		if err != nil {
+			return err
+		}
+		for i, r := range results {
+			switch {
+			case failed[i]:
+			case r.Err != nil:
+				failed[i] = true
+				var large *similar.TooLargeError
+				if onError != nil {
+					onError(r.Path, r.Err)
+				} else if !errors.As(r.Err, &large) {
+					return fmt.Errorf("%s: %w", r.Path, r.Err)
+				}
+			default:
+				hashes[i][j] = r.Hash
+			}
+		}
+	}
+
+	pos := make(map[string]int, len(names))
+	for i, name := range names {
+		pos[name] = i
+	}
+	type pair struct{ a, b int }  // a > b, as in scan order
+	dists := make(map[pair][]int) // by algorithm, -1 if not matched
+	for j := range algos {
+		idx := similar.NewIndex()
+		for i, hs := range hashes {
+			if failed[i] {
+				continue
+			}
+			for _, m := range idx.Search(hs[j], threshold) {
+				p := pair{a: i, b: pos[m.Name]}
+				if dists[p] == nil {
+					dists[p] = make([]int, len(algos))
+					for k := range dists[p] {
+						dists[p][k] = -1
+					}
+				}
+				dists[p][j] = m.Distance
+			}
+			idx.Add(similar.Entry{Name: names[i], Hash: hs[j]})
+		}
+	}
+	var found []pair
+	for p, ds := range dists {
+		var n int
+		for _, d := range ds {
+			if d >= 0 {
+				n++
+			}
+		}
+		if n >= minAlgos {
+			found = append(found, p)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].a != found[j].a {
+			return found[i].a < found[j].a
+		}
+		return found[i].b < found[j].b
+	})
+	for _, p := range found {
+		first := -1 // algorithm which hashes are reported
+		var descs []string
+		byAlgo := make(map[string]int)
+		for j, d := range dists[p] {
+			if d < 0 {
+				continue
+			}
+			if first < 0 {
+				first = j
+			}
+			descs = append(descs, fmt.Sprintf("%v dist=%d", algos[j], d))
+			byAlgo[algos[j].String()] = d
+		}
+		if structuredFormat() {
+			r := newRecord(similar.Entry{Name: names[p.a], Hash: hashes[p.a][first]},
+				similar.Entry{Name: names[p.b], Hash: hashes[p.b][first]}, dists[p][first], 0)
+			r.Distances = byAlgo
+			writeRecord(r)
+			continue
+		}
+		reportFinding(names[p.a], "close match: %q is close to %q by %s", names[p.a], names[p.b], strings.Join(descs, ", "))
+	}
+	return nil
+}
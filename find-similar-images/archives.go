@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/artyom/phash-examples/similar"
+	"golang.org/x/sync/errgroup"
+)
+
+type book struct {
+	name  string
+	pages []similar.Page
+}
+
+// reportArchives walks dir looking for comic book archives and epub books,
+// hashes their pages, and reports pages duplicated between different books,
+// and pairs of books sharing at least given fraction of pages of the smaller
+// one.
+func reportArchives(dir string, threshold, workers int, fraction float64, opts []similar.Option) error {
+	group, ctx := errgroup.WithContext(context.Background())
+	paths := make(chan string)
+	books := make(chan book)
+	group.Go(func() error {
+		defer close(paths)
+		return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() || !similar.IsArchive(p) {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case paths <- p:
+			}
+			return nil
+		})
+	})
+	var wg errgroup.Group
+	for i := 0; i < workers; i++ {
+		wg.Go(func() error {
+			for p := range paths {
+				pages, err := similar.HashArchive(p, opts...)
+				if err != nil {
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case books <- book{name: p, pages: pages}:
+				}
+			}
+			return nil
+		})
+	}
+	group.Go(func() error {
+		defer close(books)
+		return wg.Wait()
+	})
+
+	type bookPair struct{ a, b int } // indexes in seen
+	var seen []book
+	idx := similar.NewIndex()
+	owner := make(map[string]int) // index entry name to seen index
+	shared := make(map[bookPair]int)
+	for b := range books {
+		cur := len(seen)
+		seen = append(seen, b)
+		for _, page := range b.pages {
+			e := similar.Entry{Name: b.name + "#" + page.Name, Hash: page.Hash}
+			matched := make(map[int]struct{})
+			for _, m := range idx.Search(e.Hash, threshold) {
+				other := owner[m.Name]
+				if other == cur {
+					continue
+				}
+				report.Printf("duplicate page: %q in %q has phash close (dist=%d) to %q in %q",
+					page.Name, b.name, m.Distance, m.Name[len(seen[other].name)+1:], seen[other].name)
+				matched[other] = struct{}{}
+			}
+			for other := range matched {
+				shared[bookPair{a: cur, b: other}]++
+			}
+			owner[e.Name] = cur
+			idx.Add(e)
+		}
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	for pair, n := range shared {
+		a, b := seen[pair.a], seen[pair.b]
+		total := len(a.pages)
+		if len(b.pages) < total {
+			total = len(b.pages)
+		}
+		if n > total {
+			n = total
+		}
+		if float64(n) >= fraction*float64(total) {
+			report.Printf("duplicate book: %q shares %d of %d pages with %q", a.name, n, total, b.name)
+		}
+	}
+	return nil
+}
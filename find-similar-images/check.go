@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// checkIndex is an index of files being checked. Scanned files are only
+// searched against it, and not added to it.
+type checkIndex struct {
+	similar.Index
+}
+
+func (checkIndex) Add(similar.Entry) {}
+
+// check hashes image files from names, and reports those of them similar to
+// any image already in dir. It returns an error if such files were found, so
+// it can be used in a pre-commit hook. Files from names that are inside dir
+// are not matched against themselves.
+func check(dir string, names []string, opts []similar.Option) error {
+	var images []string
+	added := make(map[string]struct{})
+	for _, name := range names {
+		if !similar.IsImage(name) {
+			continue
+		}
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return err
+		}
+		images = append(images, name)
+		added[abs] = struct{}{}
+	}
+	if len(images) == 0 {
+		return nil
+	}
+	results, err := similar.HashAll(context.Background(), images, opts...)
+	if err != nil {
+		return err
+	}
+	idx := similar.NewIndex()
+	for _, r := range results {
+		if r.Err != nil {
+			return fmt.Errorf("%s: %w", r.Path, r.Err)
+		}
+		idx.Add(similar.Entry{Name: r.Path, Hash: r.Hash})
+	}
+	var found int
+	s := similar.NewScanner(append(opts, similar.WithIndex(checkIndex{Index: idx}))...)
+	err = s.Scan(context.Background(), dir, func(p similar.Pair) {
+		if abs, err := filepath.Abs(p.Name); err == nil {
+			if _, ok := added[abs]; ok {
+				return
+			}
+		}
+		found++
+		if structuredFormat() {
+			writeRecord(newRecord(p.Match.Entry, p.Entry, p.Match.Distance, 0))
+			return
+		}
+		reportFinding(p.Match.Name, "near-duplicate added: %q has phash close (dist=%d) to existing %q", p.Match.Name, p.Match.Distance, p.Name)
+	})
+	if err != nil {
+		return err
+	}
+	if found > 0 {
+		return fmt.Errorf("%d near-duplicate images are being added", found)
+	}
+	return nil
+}
+
+// readNames returns non-empty lines read from r.
+func readNames(r io.Reader) ([]string, error) {
+	var names []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if s := strings.TrimSpace(sc.Text()); s != "" {
+			names = append(names, s)
+		}
+	}
+	return names, sc.Err()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// caches is a similar.Cache looking hashes up in each of caches in turn, and
+// storing them in all
+type caches []similar.Cache
+
+func (cs caches) Get(name string, size int64, mtime time.Time) (uint64, bool) {
+	for _, c := range cs {
+		if hash, ok := c.Get(name, size, mtime); ok {
+			return hash, true
+		}
+	}
+	return 0, false
+}
+
+func (cs caches) Put(name string, size int64, mtime time.Time, hash uint64) error {
+	for _, c := range cs {
+		if err := c.Put(name, size, mtime, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushCloser is a file that buffers writes, like similar.Checkpoint
+type flushCloser interface {
+	Flush() error
+	Close() error
+}
+
+// flushPeriodically flushes f every interval, until returned function is
+// called, which also closes it and returns the error of Close. Errors of
+// periodic flushes are logged prefixed with what; as Close flushes f again,
+// the data they failed to save is then lost only if Close fails too.
+func flushPeriodically(f flushCloser, what string, interval time.Duration) (stop func() error) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := f.Flush(); err != nil {
+					log.Printf("%s: %v", what, err)
+				}
+			}
+		}
+	}()
+	return func() error {
+		close(done)
+		<-finished
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// reportContainerImage hashes images bundled in layers of a container image
+// tarball or content store, and reports images close to some image seen
+// earlier, along with the total size of such images.
+func reportContainerImage(name string, threshold int, opts []similar.Option) error {
+	assets, err := similar.HashContainerImage(name, opts...)
+	if err != nil {
+		return err
+	}
+	idx := similar.NewIndex()
+	var wasted int64
+	var dups int
+	for i, a := range assets {
+		var matched bool
+		for _, m := range idx.Search(a.Hash, threshold) {
+			j, _ := strconv.Atoi(m.Name) // entries are named by their assets index
+			b := assets[j]
+			report.Printf("duplicate asset: %q in layer %q (%d bytes) has phash close (dist=%d) to %q in layer %q",
+				a.Name, a.Layer, a.Size, m.Distance, b.Name, b.Layer)
+			matched = true
+		}
+		if matched {
+			wasted += a.Size
+			dups++
+		}
+		idx.Add(similar.Entry{Name: strconv.Itoa(i), Hash: a.Hash})
+	}
+	if dups > 0 {
+		reportStatus("%d of %d images are duplicates, taking %d bytes", dups, len(assets), wasted)
+	}
+	return nil
+}
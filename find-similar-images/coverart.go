@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar"
+)
+
+type album struct {
+	name string // "artist - album" as found in tags
+	dir  string
+	hash uint64
+}
+
+// reportCoverArt walks dir looking for audio files, and reports albums with
+// similar embedded cover art. Album is identified by its artist and title
+// tags, or by directory if files have no album tag. Only the first found
+// cover of each album is used.
+func reportCoverArt(dir string, threshold int, opts []similar.Option) error {
+	var albums []album
+	seen := make(map[string]struct{})
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !similar.IsAudio(p) {
+			return nil
+		}
+		key := filepath.Dir(p)
+		if _, ok := seen[key]; ok {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		t, err := similar.ReadTrack(f, opts...)
+		if errors.Is(err, similar.ErrNoCoverArt) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		name := t.Artist + " - " + t.Album
+		if t.Album != "" {
+			key = name
+		}
+		if _, ok := seen[key]; ok {
+			return nil
+		}
+		seen[key] = struct{}{}
+		albums = append(albums, album{name: name, dir: filepath.Dir(p), hash: t.Hash})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, a := range albums {
+		for _, b := range albums[:i] {
+			if diff := phash.Distance(a.hash, b.hash); diff <= threshold {
+				report.Printf("similar cover art: %q in %q is close (dist=%d) to %q in %q", a.name, a.dir, diff, b.name, b.dir)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar"
+)
+
+// decision is an action planned with -decisions flag. Paths are slash
+// separated, relative to the scanned directory, so that decisions can be
+// replayed on another copy of the tree.
+type decision struct {
+	Action   string `json:"action"`
+	Path     string `json:"path"`
+	Hash     string `json:"hash"`
+	Kept     string `json:"kept"`
+	KeptHash string `json:"kept_hash"`
+	// Hashing is how hashes were computed, as returned by cacheBucket;
+	// empty in files written by older versions means default options
+	Hashing string `json:"hashing,omitempty"`
+}
+
+var decisionColumns = []string{"action", "path", "hash", "kept", "kept_hash", "hashing"}
+
+// writeDecisions writes decisions to named file, as csv if name has .csv
+// extension, or as json lines otherwise.
+func writeDecisions(name string, decisions []decision) error {
+	f, err := createAtomic(name)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		w := csv.NewWriter(f)
+		w.Write(decisionColumns)
+		for _, d := range decisions {
+			w.Write([]string{d.Action, d.Path, d.Hash, d.Kept, d.KeptHash, d.Hashing})
+		}
+		if w.Flush(); w.Error() != nil {
+			f.Abort()
+			return w.Error()
+		}
+	} else {
+		enc := json.NewEncoder(f)
+		for _, d := range decisions {
+			if err := enc.Encode(d); err != nil {
+				f.Abort()
+				return err
+			}
+		}
+	}
+	if err := f.Commit(); err != nil {
+		return err
+	}
+	log.Printf("%d decisions written to %s", len(decisions), name)
+	return nil
+}
+
+// readDecisions reads file written by writeDecisions
+func readDecisions(name string) ([]decision, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []decision
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1 // older versions don't write hashing column
+		for line := 0; ; line++ {
+			rec, err := r.Read()
+			if err == io.EOF {
+				return out, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if len(rec) != len(decisionColumns) && len(rec) != len(decisionColumns)-1 {
+				return nil, fmt.Errorf("%s: line %d: wrong number of fields", name, line+1)
+			}
+			if line == 0 && rec[0] == decisionColumns[0] {
+				continue // header
+			}
+			d := decision{Action: rec[0], Path: rec[1], Hash: rec[2], Kept: rec[3], KeptHash: rec[4]}
+			if len(rec) == len(decisionColumns) {
+				d.Hashing = rec[5]
+			}
+			out = append(out, d)
+		}
+	}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var d decision
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		out = append(out, d)
+	}
+	return out, sc.Err()
+}
+
+// applyDecisions implements "apply-decisions" subcommand: it performs
+// actions planned with -decisions flag on a copy of the tree they were
+// planned on. Files are looked up by their relative paths, and each action is
+// only performed if both the duplicate and the kept image there still have
+// the recorded hashes, computed with the same options as they were.
+func applyDecisions(argv []string) error {
+	fs := flag.NewFlagSet("apply-decisions", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: find-similar-images apply-decisions [flags] decisions.jsonl dir")
+		fs.PrintDefaults()
+	}
+	threshold := fs.Int("t", 0, "largest distance between recorded and current hash of a file")
+	quarantine := fs.String("quarantine", "", "directory to move duplicates to, for move actions")
+	manifest := fs.String("manifest", "undo.jsonl", "file to append actions taken to, for \"undo\" subcommand")
+	dryRun := fs.Bool("dry-run", false, "only report what would be done")
+	fs.Parse(argv)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *threshold < 0 || *threshold > 64 {
+		return errors.New("-t must be in 0..64 range")
+	}
+	decisions, err := readDecisions(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dir := fs.Arg(1)
+	var recs []undoRecord
+	var skipped int
+	type hashKey struct{ name, hashing string }
+	hashes := make(map[hashKey]uint64) // kept images are usually shared
+	matches := func(name, hash, hashing string) bool {
+		want, err := strconv.ParseUint(hash, 16, 64)
+		if err != nil {
+			log.Printf("skipping %q: invalid hash %q", name, hash)
+			return false
+		}
+		got, ok := hashes[hashKey{name, hashing}]
+		if !ok {
+			opts, err := hashingOptions(hashing)
+			if err != nil {
+				log.Printf("skipping %q: %v", name, err)
+				return false
+			}
+			if got, err = similar.HashFile(name, opts...); err != nil {
+				log.Printf("skipping %q: %v", name, err)
+				return false
+			}
+			hashes[hashKey{name, hashing}] = got
+		}
+		if d := phash.Distance(got, want); d > *threshold {
+			log.Printf("skipping %q: its hash changed (dist=%d)", name, d)
+			return false
+		}
+		return true
+	}
+	for _, d := range decisions {
+		switch d.Action {
+		case "move":
+			if *quarantine == "" {
+				return errors.New("move decisions require -quarantine directory")
+			}
+		case "hardlink", "delete":
+		default:
+			return fmt.Errorf("unsupported action %q", d.Action)
+		}
+		rel, kept := filepath.FromSlash(d.Path), filepath.FromSlash(d.Kept)
+		if !filepath.IsLocal(rel) || !filepath.IsLocal(kept) {
+			return fmt.Errorf("decision paths must be relative: %q, %q", d.Path, d.Kept)
+		}
+		if filepath.Clean(rel) == filepath.Clean(kept) {
+			return fmt.Errorf("decision keeps the file it acts on: %q", d.Path)
+		}
+		rec := undoRecord{Action: d.Action, Path: filepath.Join(dir, rel), Kept: filepath.Join(dir, kept)}
+		if err := distinctFiles(rec.Path, rec.Kept); err != nil {
+			log.Printf("skipping %q: %v", rec.Path, err)
+			skipped++
+			continue
+		}
+		if !matches(rec.Path, d.Hash, d.Hashing) || !matches(rec.Kept, d.KeptHash, d.Hashing) {
+			skipped++
+			continue
+		}
+		if d.Action == "move" {
+			rec.MovedTo = filepath.Join(*quarantine, rel)
+		}
+		recs = append(recs, rec)
+	}
+	if err := perform(recs, *manifest, *dryRun); err != nil {
+		return err
+	}
+	if skipped > 0 {
+		return fmt.Errorf("%d of %d decisions skipped", skipped, len(decisions))
+	}
+	return nil
+}
+
+// distinctFiles returns an error unless both named files exist and are not
+// the same file, like hard links to each other are, so acting on one of them
+// leaves a copy.
+func distinctFiles(name, kept string) error {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	kfi, err := os.Stat(kept)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(fi, kfi) {
+		return fmt.Errorf("it is the same file as kept %q", kept)
+	}
+	return nil
+}
+
+// hashingOptions returns options to compute hashes with, as described by
+// decision.Hashing
+func hashingOptions(hashing string) ([]similar.Option, error) {
+	fields := strings.Fields(hashing)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	algo, err := similar.ParseAlgorithm(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	opts := []similar.Option{similar.WithAlgorithm(algo)}
+	for _, f := range fields[1:] {
+		switch {
+		case strings.HasPrefix(f, "luma="):
+			luma, err := similar.ParseLuma(strings.TrimPrefix(f, "luma="))
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, similar.WithLuma(luma))
+		case f == "normalize":
+			opts = append(opts, similar.WithNormalize())
+		case f == "watermark":
+			opts = append(opts, similar.WithWatermarkMask())
+		case f == "scaled":
+			opts = append(opts, similar.WithScaledDecode())
+		default:
+			return nil, fmt.Errorf("unsupported hashing option %q", f)
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+func TestApplyDecisionsSameFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.png")
+	writePNG(t, name)
+	if err := os.Link(name, filepath.Join(dir, "link.png")); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := similar.HashFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := fmt.Sprintf("%016x", hash)
+	for _, tc := range []struct {
+		name    string
+		d       decision
+		wantErr string
+	}{
+		{"same path", decision{Action: "delete", Path: "a.png", Hash: h, Kept: "./a.png", KeptHash: h},
+			"keeps the file it acts on"},
+		{"hard link", decision{Action: "delete", Path: "a.png", Hash: h, Kept: "link.png", KeptHash: h},
+			"1 of 1 decisions skipped"},
+		{"hard link replaced", decision{Action: "hardlink", Path: "link.png", Hash: h, Kept: "a.png", KeptHash: h},
+			"1 of 1 decisions skipped"},
+		{"kept missing", decision{Action: "delete", Path: "a.png", Hash: h, Kept: "gone.png", KeptHash: h},
+			"1 of 1 decisions skipped"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			decisions := filepath.Join(t.TempDir(), "decisions.jsonl")
+			if err := writeDecisions(decisions, []decision{tc.d}); err != nil {
+				t.Fatal(err)
+			}
+			manifest := filepath.Join(t.TempDir(), "undo.jsonl")
+			err := applyDecisions([]string{"-manifest", manifest, decisions, dir})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tc.wantErr)
+			}
+			for _, name := range []string{"a.png", "link.png"} {
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func writePNG(t *testing.T, name string) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(4*x ^ 5*y)})
+		}
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
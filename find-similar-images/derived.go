@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// derivative reports whether one of two similar images is likely derived
+// from the other one, rather than being its duplicate, judging by their
+// names. Both have to be in the same directory, and either:
+//
+//   - names only differ in edit markers, as in IMG_001.jpg and
+//     IMG_001_edited.jpg, IMG_001-Edit.jpg, IMG_001 (Edited).jpg, or
+//     IMG_E001.jpg, as exported by Apple Photos;
+//   - they only differ in extension, and one of them is a video, like a Live
+//     Photo companion: with -video-interval, video frames are matched
+//     against images.
+//
+// RAW+JPEG pairs need no special handling, as camera raw files are not
+// decoded, and so never matched.
+func derivative(a, b string) bool {
+	a, b = stripFrame(a), stripFrame(b)
+	if filepath.Dir(a) != filepath.Dir(b) {
+		return false
+	}
+	a, b = filepath.Base(a), filepath.Base(b)
+	extA, extB := strings.ToLower(filepath.Ext(a)), strings.ToLower(filepath.Ext(b))
+	stemA, stemB := strings.ToLower(a[:len(a)-len(extA)]), strings.ToLower(b[:len(b)-len(extB)])
+	if stemA == stemB {
+		return extA != extB && (extA == ".mov" || extB == ".mov" || extA == ".mp4" || extB == ".mp4")
+	}
+	origA, editedA := originalStem(stemA)
+	origB, editedB := originalStem(stemB)
+	return origA == origB && (editedA || editedB)
+}
+
+// originalStem strips edit marker from lowercase file name stem, and
+// reports whether it had one
+func originalStem(stem string) (string, bool) {
+	if strings.HasPrefix(stem, "img_e") {
+		return "img_" + stem[len("img_e"):], true
+	}
+	for _, marker := range [...]string{"_edited", "-edited", " edited", " (edited)", "_edit", "-edit", " edit"} {
+		if strings.HasSuffix(stem, marker) {
+			return stem[:len(stem)-len(marker)], true
+		}
+	}
+	return stem, false
+}
+
+// stripFrame returns video file name of a video frame name (see
+// similar.FrameName), or name as is
+func stripFrame(name string) string {
+	if i := strings.LastIndex(name, "#t="); i > 0 {
+		return name[:i]
+	}
+	return name
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// dirIndex wraps an index, recording hashes of all added images by their
+// directory.
+type dirIndex struct {
+	similar.Index
+	mu   sync.Mutex
+	dirs map[string][]uint64
+}
+
+func (d *dirIndex) Add(e similar.Entry) {
+	d.mu.Lock()
+	dir := filepath.Dir(e.Name)
+	d.dirs[dir] = append(d.dirs[dir], e.Hash)
+	d.mu.Unlock()
+	d.Index.Add(e)
+}
+
+// report logs pairs of directories with at least minSimilarity estimated
+// fraction of shared image hashes. Directories with less than two images are
+// ignored.
+func (d *dirIndex) report(minSimilarity float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var names []string
+	for dir, hashes := range d.dirs {
+		if len(hashes) > 1 {
+			names = append(names, dir)
+		}
+	}
+	sort.Strings(names)
+	sigs := make([]similar.Signature, len(names))
+	type bandKey struct {
+		pos  int
+		hash uint64
+	}
+	buckets := make(map[bandKey][]int)
+	for i, dir := range names {
+		sigs[i] = similar.MinHash(d.dirs[dir])
+		for pos, h := range sigs[i].Bands() {
+			k := bandKey{pos: pos, hash: h}
+			buckets[k] = append(buckets[k], i)
+		}
+	}
+	type pair struct{ a, b int }
+	checked := make(map[pair]struct{})
+	var found []pair
+	for _, ids := range buckets {
+		for i, a := range ids {
+			for _, b := range ids[i+1:] {
+				p := pair{a: a, b: b}
+				if _, ok := checked[p]; ok {
+					continue
+				}
+				checked[p] = struct{}{}
+				if sigs[a].Similarity(&sigs[b]) >= minSimilarity {
+					found = append(found, p)
+				}
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].a != found[j].a {
+			return found[i].a < found[j].a
+		}
+		return found[i].b < found[j].b
+	})
+	for _, p := range found {
+		report.Printf("similar directories: %q and %q share about %.0f%% of images",
+			names[p.a], names[p.b], 100*sigs[p.a].Similarity(&sigs[p.b]))
+	}
+}
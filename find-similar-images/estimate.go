@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"image"
+	"log"
+	"os"
+	"time"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// estimateSamples is the number of files -estimate hashes to measure speed
+const estimateSamples = 10
+
+// estimate implements -estimate flag: it walks dir as a scan would, counting
+// images and their total size, hashes a few of them spread over the tree,
+// and logs projected scan duration with given number of workers, and memory
+// needed to decode the largest image found. Images with hashes already in
+// -cache are not accounted for, so the projection is that of the first run.
+func estimate(dir string, workers int, opts []similar.Option) error {
+	type file struct {
+		name string
+		size int64
+	}
+	var files []file
+	var total int64
+	largest := -1
+	err := similar.Walk(context.Background(), dir, func(name string, info os.FileInfo) error {
+		if largest < 0 || info.Size() > files[largest].size {
+			largest = len(files)
+		}
+		files = append(files, file{name: name, size: info.Size()})
+		total += info.Size()
+		return nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	log.Printf("estimate: %d files, %.1f MiB", len(files), float64(total)/(1<<20))
+	if len(files) == 0 {
+		return nil
+	}
+	var sampled int
+	var sampledSize int64
+	var elapsed time.Duration
+	step := (len(files) + estimateSamples - 1) / estimateSamples
+	for i := 0; i < len(files); i += step {
+		start := time.Now()
+		if _, err := similar.HashFile(files[i].name, opts...); err != nil {
+			log.Printf("estimate: %q: %v", files[i].name, err)
+			continue
+		}
+		elapsed += time.Since(start)
+		sampled++
+		sampledSize += files[i].size
+	}
+	if sampled == 0 || sampledSize == 0 {
+		log.Print("estimate: none of sampled files could be hashed")
+		return nil
+	}
+	rate := float64(sampledSize) / elapsed.Seconds() // bytes per second per worker
+	eta := time.Duration(float64(total) / rate / float64(workers) * float64(time.Second))
+	log.Printf("estimate: hashed %d sample files at %.1f MiB/s, scan would take about %v with %d workers",
+		sampled, rate/(1<<20), eta.Round(time.Second), workers)
+	if f, err := os.Open(files[largest].name); err == nil {
+		cfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err == nil {
+			// decoded images take up to 4 bytes per pixel
+			perWorker := float64(4*cfg.Width*cfg.Height) / (1 << 20)
+			log.Printf("estimate: largest file %q is %d×%d pixels, decoding such images needs about %.0f MiB per worker, %.0f MiB with %d workers",
+				files[largest].name, cfg.Width, cfg.Height, perWorker, perWorker*float64(workers), workers)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// reportFormat is how image matches are reported, as set by -format flag:
+// "text", "github", "json" or "csv"
+var reportFormat = "text"
+
+// structuredFormat reports whether matches are reported as records for
+// machines rather than as messages for people
+func structuredFormat() bool { return reportFormat == "json" || reportFormat == "csv" }
+
+// record is an image match reported in json and csv formats
+type record struct {
+	Path          string `json:"path"`
+	Hash          string `json:"hash"`
+	Match         string `json:"match"`
+	MatchHash     string `json:"match_hash"`
+	Distance      int    `json:"distance"`
+	Group         int    `json:"group,omitempty"`
+	Checksum      string `json:"checksum,omitempty"`
+	MatchChecksum string `json:"match_checksum,omitempty"`
+	// RawOrientation is the name of image which EXIF orientation was
+	// ignored to find this match, see -raw-orientation
+	RawOrientation string `json:"raw_orientation,omitempty"`
+	// Derivative is set if one image is likely derived from the other one,
+	// see -skip-derivatives
+	Derivative bool `json:"derivative,omitempty"`
+	// Transform is how image was transformed to match, see -invariant
+	Transform string `json:"transform,omitempty"`
+	// Tiles is the number of matching tiles, see -tiles
+	Tiles int `json:"tiles,omitempty"`
+	// MatchedHash is the raw hash, or hash of transformed image, compared
+	// in place of hash of that image
+	MatchedHash string `json:"matched_hash,omitempty"`
+	// Distances are distances by each algorithm that matched, when
+	// several -algo are combined; Hash, MatchHash and Distance are then
+	// those of the first of them
+	Distances map[string]int `json:"distances,omitempty"`
+}
+
+func newRecord(e, match similar.Entry, dist, group int) record {
+	r := record{
+		Path:      e.Name,
+		Hash:      fmt.Sprintf("%016x", e.Hash),
+		Match:     match.Name,
+		MatchHash: fmt.Sprintf("%016x", match.Hash),
+		Distance:  dist,
+		Group:     group,
+	}
+	if e.Checksum != nil {
+		r.Checksum = fmt.Sprintf("%s:%x", checksumName, e.Checksum)
+	}
+	if match.Checksum != nil {
+		r.MatchChecksum = fmt.Sprintf("%s:%x", checksumName, match.Checksum)
+	}
+	return r
+}
+
+// csvHeaderDone is set once csv header is written
+var csvHeaderDone bool
+
+// writeRecord writes record to report in json or csv format: json records
+// are written one per line.
+func writeRecord(r record) {
+	if reportFormat == "json" {
+		b, err := json.Marshal(r)
+		if err != nil {
+			panic(err) // record only has strings and numbers
+		}
+		report.Print(string(b))
+		return
+	}
+	w := csv.NewWriter(report.Writer())
+	if !csvHeaderDone {
+		w.Write([]string{"path", "hash", "match", "match_hash", "distance", "group", "checksum", "match_checksum", "raw_orientation", "derivative", "transform", "tiles", "matched_hash", "distances"})
+		csvHeaderDone = true
+	}
+	group := ""
+	if r.Group != 0 {
+		group = strconv.Itoa(r.Group)
+	}
+	tiles := ""
+	if r.Tiles != 0 {
+		tiles = strconv.Itoa(r.Tiles)
+	}
+	var dists []string // as algo=dist, space separated
+	for algo, d := range r.Distances {
+		dists = append(dists, algo+"="+strconv.Itoa(d))
+	}
+	sort.Strings(dists)
+	w.Write([]string{r.Path, r.Hash, r.Match, r.MatchHash, strconv.Itoa(r.Distance), group, r.Checksum, r.MatchChecksum, r.RawOrientation,
+		strconv.FormatBool(r.Derivative), r.Transform, tiles, r.MatchedHash, strings.Join(dists, " ")})
+	w.Flush()
+}
+
+// groupTracker assigns group ids to matched images as they are reported: an
+// image joins the group of an image it matched, or starts a new group with
+// it, and a pair of images of different groups merges them into the group
+// with the smaller id. Since records are written as pairs are found, ids of
+// earlier records are not updated on merges: two ids refer to the same group
+// if a later record has an image reported under both of them, and ids are
+// only final at the end of the run.
+type groupTracker struct {
+	ids    map[string]int // image to id of its group when it was added
+	parent map[int]int    // union-find forest over group ids
+	last   int
+}
+
+// add returns group id for pair
+func (g *groupTracker) add(p similar.Pair) int {
+	a, aok := g.ids[p.Match.Name]
+	b, bok := g.ids[p.Name]
+	var id int
+	switch {
+	case aok && bok:
+		a, b = g.find(a), g.find(b)
+		id = min(a, b)
+		g.parent[max(a, b)] = id
+	case aok:
+		id = g.find(a)
+	case bok:
+		id = g.find(b)
+	default:
+		if g.parent == nil {
+			g.parent = make(map[int]int)
+		}
+		g.last++
+		id = g.last
+		g.parent[id] = id
+	}
+	g.ids[p.Match.Name], g.ids[p.Name] = id, id
+	return id
+}
+
+func (g *groupTracker) find(id int) int {
+	root := id
+	for g.parent[root] != root {
+		root = g.parent[root]
+	}
+	for id != root { // path compression
+		next := g.parent[id]
+		g.parent[id] = root
+		id = next
+	}
+	return root
+}
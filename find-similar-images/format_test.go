@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+func TestGroupTracker(t *testing.T) {
+	pair := func(a, b string) similar.Pair {
+		var p similar.Pair
+		p.Name, p.Match.Name = a, b
+		return p
+	}
+	g := &groupTracker{ids: make(map[string]int)}
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"a", "b", 1},
+		{"c", "d", 2},
+		{"e", "f", 3},
+		{"c", "b", 1}, // merges group 2 into 1
+		{"d", "g", 1},
+		{"f", "d", 1}, // merges group 3 into 1
+		{"e", "h", 1},
+		{"i", "j", 4},
+	} {
+		if got := g.add(pair(tc.a, tc.b)); got != tc.want {
+			t.Fatalf("pair %s-%s got group %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
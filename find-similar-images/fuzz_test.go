@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// FuzzReadDecisions checks that reading decisions doesn't panic on arbitrary
+// json and csv files, and that decisions read from them are written and read
+// back unchanged.
+func FuzzReadDecisions(f *testing.F) {
+	decisions := []decision{
+		{Action: "move", Path: "sub/a-copy.jpg", Hash: "e272c90900000000", Kept: "a.jpg", KeptHash: "e272c90900000000"},
+		{Action: "delete", Path: "b, \"quoted\".png", Hash: "8fd33d3d9f65f37d", Kept: "b.png",
+			KeptHash: "8fd33d3d9f65f17d", Hashing: "dhash luma=709 normalize"},
+	}
+	for _, ext := range []string{".jsonl", ".csv"} {
+		name := filepath.Join(f.TempDir(), "decisions"+ext)
+		if err := writeDecisions(name, decisions); err != nil {
+			f.Fatal(err)
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b, ext == ".csv")
+	}
+	f.Add([]byte("action,path,hash,kept,kept_hash\ndelete,a.jpg,0,b.jpg,0\n"), true) // older format
+	f.Add([]byte("{\"action\":\"delete\"\n"), false)
+	f.Add([]byte("a,\"b\n"), true)
+	f.Fuzz(func(t *testing.T, b []byte, csv bool) {
+		ext := ".jsonl"
+		if csv {
+			ext = ".csv"
+		}
+		dir := t.TempDir()
+		name := filepath.Join(dir, "in"+ext)
+		if err := os.WriteFile(name, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readDecisions(name)
+		if err != nil {
+			return
+		}
+		out := filepath.Join(dir, "out"+ext)
+		if err := writeDecisions(out, got); err != nil {
+			t.Fatal(err)
+		}
+		again, err := readDecisions(out)
+		if err != nil {
+			t.Fatalf("reading written decisions: %v", err)
+		}
+		if len(got) != 0 && !reflect.DeepEqual(got, again) {
+			t.Fatalf("decisions written and read back differ:\n%+v\n%+v", got, again)
+		}
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// reportGitHistory hashes images found anywhere in history of git repository
+// at dir, and reports images close to ones added by earlier commits, along
+// with commits introducing them.
+func reportGitHistory(dir string, threshold int, opts []similar.Option) error {
+	blobs, err := similar.HashGitHistory(context.Background(), dir, opts...)
+	if err != nil {
+		return err
+	}
+	idx := similar.NewIndex()
+	for i, b := range blobs {
+		for _, m := range idx.Search(b.Hash, threshold) {
+			j, _ := strconv.Atoi(m.Name) // entries are named by their blobs index
+			other := blobs[j]
+			report.Printf("duplicate asset: %q added in commit %.12s has phash close (dist=%d) to %q from commit %.12s",
+				b.Path, b.Commit, m.Distance, other.Path, other.Commit)
+		}
+		idx.Add(similar.Entry{Name: strconv.Itoa(i), Hash: b.Hash})
+	}
+	return nil
+}
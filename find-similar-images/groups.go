@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// member is an image of a duplicate group
+type member struct {
+	similar.Entry
+	Width, Height int
+	Size          int64
+	ModTime       time.Time
+	Exif          similar.Exif
+}
+
+// pixels returns image resolution in pixels
+func (m member) pixels() int { return m.Width * m.Height }
+
+// taken returns time photo was taken as in EXIF, or an empty string
+func (m member) taken() string {
+	if m.Exif.Taken.IsZero() {
+		return ""
+	}
+	return m.Exif.Taken.Format("2006-01-02 15:04:05")
+}
+
+// exifSummary returns EXIF metadata for text reports, starting with a comma,
+// or an empty string if there's none
+func (m member) exifSummary() string {
+	var s string
+	if t := m.taken(); t != "" {
+		s += ", taken " + t
+	}
+	if m.Exif.Camera != "" {
+		s += ", " + m.Exif.Camera
+	}
+	if m.Exif.Orientation > 1 {
+		s += fmt.Sprintf(", orientation %d", m.Exif.Orientation)
+	}
+	if m.Exif.GPS {
+		s += ", has location"
+	}
+	return s
+}
+
+// newMember reads image dimensions, file size, modification time and EXIF
+// metadata. They are left zero if file can't be read, or if entry is not a
+// file, like video frames are.
+func newMember(e similar.Entry) member {
+	m := member{Entry: e}
+	f, err := os.Open(e.Name)
+	if err != nil {
+		return m
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil {
+		m.Size, m.ModTime = fi.Size(), fi.ModTime()
+	}
+	if cfg, _, err := image.DecodeConfig(f); err == nil {
+		m.Width, m.Height = cfg.Width, cfg.Height
+	}
+	m.Exif, _ = similar.ReadExif(e.Name)
+	return m
+}
+
+// sortedGroups returns groups with members sorted by -keep policy, the best
+// one first.
+func sortedGroups(groups *similar.Groups) [][]member {
+	var out [][]member
+	for _, entries := range groups.List() {
+		ms := make([]member, len(entries))
+		for i, e := range entries {
+			ms[i] = newMember(e)
+		}
+		sort.SliceStable(ms, func(i, j int) bool { return keepOrder.better(ms[i], ms[j]) })
+		out = append(out, ms)
+	}
+	return out
+}
+
+// reportGroups reports each group of similar images once, in the format set
+// by -format flag.
+func reportGroups(groups *similar.Groups) {
+	for i, ms := range sortedGroups(groups) {
+		id := i + 1
+		switch reportFormat {
+		case "json":
+			type image struct {
+				Path   string `json:"path"`
+				Hash   string `json:"hash"`
+				Width  int    `json:"width,omitempty"`
+				Height int    `json:"height,omitempty"`
+				Size   int64  `json:"size,omitempty"`
+				Taken  string `json:"taken,omitempty"`
+				Camera string `json:"camera,omitempty"`
+				Orient int    `json:"orientation,omitempty"`
+				GPS    bool   `json:"gps,omitempty"`
+			}
+			rec := struct {
+				Group  int     `json:"group"`
+				Images []image `json:"images"`
+			}{Group: id}
+			for _, m := range ms {
+				rec.Images = append(rec.Images, image{Path: m.Name, Hash: fmt.Sprintf("%016x", m.Hash),
+					Width: m.Width, Height: m.Height, Size: m.Size,
+					Taken: m.taken(), Camera: m.Exif.Camera, Orient: m.Exif.Orientation, GPS: m.Exif.GPS})
+			}
+			b, err := json.Marshal(rec)
+			if err != nil {
+				panic(err) // only strings and numbers
+			}
+			report.Print(string(b))
+		case "csv":
+			w := csv.NewWriter(report.Writer())
+			if i == 0 {
+				w.Write([]string{"group", "path", "hash", "width", "height", "size", "taken", "camera", "orientation", "gps"})
+			}
+			for _, m := range ms {
+				w.Write([]string{strconv.Itoa(id), m.Name, fmt.Sprintf("%016x", m.Hash),
+					strconv.Itoa(m.Width), strconv.Itoa(m.Height), strconv.FormatInt(m.Size, 10),
+					m.taken(), m.Exif.Camera, strconv.Itoa(m.Exif.Orientation), strconv.FormatBool(m.Exif.GPS)})
+			}
+			w.Flush()
+		default:
+			report.Printf("group %d, %d images:", id, len(ms))
+			for _, m := range ms {
+				reportFinding(m.Name, "\t%s %dx%d, %d bytes, phash %016x%s", describe(m.Entry), m.Width, m.Height, m.Size, m.Hash, m.exifSummary())
+			}
+		}
+	}
+}
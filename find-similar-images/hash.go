@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// hashFiles implements "hash" subcommand: it prints hashes of given image
+// files, optionally of their region only.
+func hashFiles(argv []string) error {
+	fs := flag.NewFlagSet("hash", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: find-similar-images hash [flags] file...")
+		fs.PrintDefaults()
+	}
+	var crop cropRect
+	fs.Var(&crop, "crop", "only hash this region of images, given as x,y,w,h in pixels from the top left corner")
+	fs.Parse(argv)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var opts []similar.Option
+	if crop.set {
+		opts = append(opts, similar.WithCrop(crop.r))
+	}
+	for _, name := range fs.Args() {
+		hash, err := similar.HashFile(name, opts...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Printf("%016x\t%s\n", hash, name)
+	}
+	return nil
+}
+
+// cropRect is a flag.Value holding rectangle in x,y,w,h form
+type cropRect struct {
+	r   image.Rectangle
+	set bool
+}
+
+func (c *cropRect) String() string {
+	if !c.set {
+		return ""
+	}
+	return fmt.Sprintf("%d,%d,%d,%d", c.r.Min.X, c.r.Min.Y, c.r.Dx(), c.r.Dy())
+}
+
+func (c *cropRect) Set(s string) error {
+	fields := strings.Split(s, ",")
+	if len(fields) != 4 {
+		return errors.New("must be x,y,w,h")
+	}
+	var v [4]int
+	for i, f := range fields {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 0 {
+			return errors.New("must be x,y,w,h non-negative integers")
+		}
+		v[i] = n
+	}
+	if v[2] == 0 || v[3] == 0 {
+		return errors.New("width and height must not be zero")
+	}
+	c.r, c.set = image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), true
+	return nil
+}
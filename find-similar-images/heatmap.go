@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"sort"
+	"sync"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar"
+)
+
+// entryIndex wraps an index, recording all added entries.
+type entryIndex struct {
+	similar.Index
+	mu      sync.Mutex
+	entries []similar.Entry
+}
+
+func (x *entryIndex) Add(e similar.Entry) {
+	x.mu.Lock()
+	x.entries = append(x.entries, e)
+	x.mu.Unlock()
+	x.Index.Add(e)
+}
+
+const (
+	maxHeatmapImages = 10000 // all pairs are compared, so keep it bounded
+	maxHeatmapSide   = 1024  // heatmap image side, in pixels
+)
+
+// writeHeatmap writes a png image of pairwise distances between all entries:
+// pixel at x, y shows distance between images x and y, bright for similar
+// images, black for distance of 32 and more. Entries are ordered by groups,
+// so that groups of similar images show up as bright squares along the
+// diagonal; images not in any group follow, ordered by hash. For more than
+// maxHeatmapSide images, each pixel shows the smallest distance of the
+// images it covers.
+func writeHeatmap(name string, entries []similar.Entry, groups *similar.Groups) error {
+	if len(entries) > maxHeatmapImages {
+		return fmt.Errorf("too many images for a heatmap: %d, at most %d are supported", len(entries), maxHeatmapImages)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no images for a heatmap")
+	}
+	var hashes []uint64
+	grouped := make(map[string]bool)
+	for _, group := range groups.List() {
+		for _, e := range group {
+			hashes = append(hashes, e.Hash)
+			grouped[e.Name] = true
+		}
+	}
+	rest := make([]uint64, 0, len(entries)-len(hashes))
+	for _, e := range entries {
+		if !grouped[e.Name] {
+			rest = append(rest, e.Hash)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i] < rest[j] })
+	hashes = append(hashes, rest...)
+
+	n := len(hashes)
+	side := n
+	if side > maxHeatmapSide {
+		side = maxHeatmapSide
+	}
+	img := image.NewRGBA(image.Rect(0, 0, side, side))
+	for py := 0; py < side; py++ {
+		for px := 0; px <= py; px++ {
+			dist := 64
+			for y := py * n / side; y < (py+1)*n/side; y++ {
+				for x := px * n / side; x < (px+1)*n/side; x++ {
+					if x == y {
+						continue
+					}
+					if d := phash.Distance(hashes[x], hashes[y]); d < dist {
+						dist = d
+					}
+				}
+			}
+			c := heat(dist)
+			img.SetRGBA(px, py, c)
+			img.SetRGBA(py, px, c)
+		}
+	}
+	f, err := createAtomic(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// heat maps distance to a black-red-yellow-white color scale, white being
+// the most similar
+func heat(dist int) color.RGBA {
+	const far = 32
+	if dist > far {
+		dist = far
+	}
+	t := 3 * 255 * (far - dist) / far // 0..765
+	c := color.RGBA{A: 255}
+	for _, v := range []*uint8{&c.R, &c.G, &c.B} {
+		switch {
+		case t >= 255:
+			*v, t = 255, t-255
+		default:
+			*v, t = uint8(t), 0
+		}
+	}
+	return c
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"image/jpeg"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar"
+	"github.com/disintegration/imaging"
+)
+
+// thumbSize is the size of thumbnails in -html report, in pixels
+const thumbSize = 200
+
+// writeHTML writes a self-contained html page showing thumbnails of each
+// group of similar images side by side, with their sizes, resolutions, and
+// distances to the best image of the group, the one -action would keep.
+func writeHTML(name string, groups *similar.Groups) error {
+	type image struct {
+		member
+		Distance int
+		Thumb    template.URL // data URI, empty if image can't be decoded
+	}
+	var data [][]image
+	for _, ms := range sortedGroups(groups) {
+		images := make([]image, len(ms))
+		for i, m := range ms {
+			images[i] = image{member: m, Distance: phash.Distance(m.Hash, ms[0].Hash), Thumb: thumbnail(m.Name)}
+		}
+		data = append(data, images)
+	}
+	f, err := createAtomic(name)
+	if err != nil {
+		return err
+	}
+	if err := htmlReport.Execute(f, data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// thumbnail returns data URI of named image thumbnail, or an empty string if
+// image can't be decoded
+func thumbnail(name string) template.URL {
+	img, err := imaging.Open(name, imaging.AutoOrientation(true))
+	if err != nil {
+		return ""
+	}
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, imaging.Fit(img, thumbSize, thumbSize, imaging.Lanczos), nil); err != nil {
+		return ""
+	}
+	return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Similar images</title>
+<style>
+body{font-family:sans-serif;margin:1em}
+section{border-bottom:1px solid #ccc;padding:1em 0}
+figure{display:inline-block;vertical-align:top;margin:0 1em 1em 0;width:220px;font-size:small}
+figure img{max-width:200px;max-height:200px;display:block}
+figure.best{font-weight:bold}
+figcaption{word-break:break-all}
+</style></head><body>
+<h1>{{len .}} groups of similar images</h1>
+{{range $i, $g := .}}<section><h2>Group {{inc $i}}, {{len $g}} images</h2>
+{{range $j, $m := $g}}<figure{{if eq $j 0}} class="best"{{end}}>
+{{if $m.Thumb}}<img src="{{$m.Thumb}}" alt="">{{else}}<p>no preview</p>{{end}}
+<figcaption>{{$m.Name}}<br>{{if $m.Width}}{{$m.Width}}×{{$m.Height}}, {{end}}{{$m.Size}} bytes<br>
+phash {{printf "%016x" $m.Hash}}{{if $j}}, distance {{$m.Distance}}{{else}}, best copy{{end}}</figcaption>
+</figure>
+{{end}}</section>
+{{end}}</body></html>
+`))
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keepCriterion orders members of a duplicate group, see -keep
+type keepCriterion string
+
+// keepCriteria are supported -keep criteria, and functions reporting
+// whether a is better than b by them, or 0 if neither is
+var keepCriteria = map[keepCriterion]func(a, b member) int{
+	"resolution": func(a, b member) int { return compare(int64(a.pixels()), int64(b.pixels())) },
+	"size":       func(a, b member) int { return compare(a.Size, b.Size) },
+	"oldest": func(a, b member) int {
+		switch {
+		case a.ModTime.Before(b.ModTime):
+			return 1
+		case b.ModTime.Before(a.ModTime):
+			return -1
+		}
+		return 0
+	},
+	"gps": func(a, b member) int { return compare(b2i(a.Exif.GPS), b2i(b.Exif.GPS)) },
+}
+
+func compare(a, b int64) int {
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return -1
+	}
+	return 0
+}
+
+func b2i(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// keepPolicy is a flag.Value holding a comma separated list of criteria
+// deciding which member of a duplicate group is the best one, the first
+// criterion taking precedence
+type keepPolicy []keepCriterion
+
+// keepOrder is the policy set by -keep flag
+var keepOrder = keepPolicy{"resolution", "size"}
+
+func (p *keepPolicy) String() string {
+	names := make([]string, len(*p))
+	for i, c := range *p {
+		names[i] = string(c)
+	}
+	return strings.Join(names, ",")
+}
+
+func (p *keepPolicy) Set(s string) error {
+	var out keepPolicy
+	for _, name := range strings.Split(s, ",") {
+		c := keepCriterion(strings.TrimSpace(name))
+		if _, ok := keepCriteria[c]; !ok {
+			return fmt.Errorf("unknown criterion %q", c)
+		}
+		out = append(out, c)
+	}
+	*p = out
+	return nil
+}
+
+// better reports whether a should be kept rather than b
+func (p keepPolicy) better(a, b member) bool {
+	for _, c := range p {
+		if v := keepCriteria[c](a, b); v != 0 {
+			return v > 0
+		}
+	}
+	return false
+}
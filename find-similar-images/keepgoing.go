@@ -0,0 +1,27 @@
+package main
+
+import "log"
+
+// fileErrors collects errors of individual files skipped with -keep-going
+// flag
+type fileErrors struct {
+	names []string
+	errs  []error
+}
+
+// add records error of named file; calls are serialized by Scanner
+func (fe *fileErrors) add(name string, err error) {
+	fe.names = append(fe.names, name)
+	fe.errs = append(fe.errs, err)
+}
+
+// report logs all recorded errors
+func (fe *fileErrors) report() {
+	if len(fe.errs) == 0 {
+		return
+	}
+	log.Printf("%d files could not be processed:", len(fe.errs))
+	for i, err := range fe.errs {
+		log.Printf("\t%q: %v", fe.names[i], err)
+	}
+}
@@ -1,138 +1,899 @@
-// Command find-similar-images scans directory for jpeg images and reports any
-// similar images (potential duplicates).
+// Command find-similar-images scans directory for jpeg, png, gif, webp and
+// tiff images and reports any similar images (potential duplicates).
+//
+// HEIC/HEIF images, like iPhone photos, are also scanned if the command is
+// built with heif tag, which requires libheif and its headers installed:
+//
+//	go build -tags heif
+//
+// A running scan can be paused by sending the process SIGUSR1, and resumed
+// with SIGUSR2. Scan progress is printed on pause, and periodically with
+// -progress flag.
+//
+// Matches between hashes stored in a -cache database can be reported again
+// at a different threshold without reading any images:
+//
+//	find-similar-images rethreshold -t 8 index.db
+//
+// Hashes of individual images, or of their regions, are printed with:
+//
+//	find-similar-images hash [-crop x,y,w,h] file...
+//
+// With -action flag, duplicates are moved to a quarantine directory, replaced
+// with hard links to the best copy, or deleted, or the best copy is renamed
+// to a canonical name. Moves and renames recorded in -manifest file can be
+// reverted with:
+//
+//	find-similar-images undo manifest.jsonl
+//
+// Actions planned with -decisions flag can be replayed on another copy of the
+// same tree, checking that files there have the same hashes:
+//
+//	find-similar-images apply-decisions decisions.jsonl dir
+//
+// Images in a directory can be indexed once and then looked up over HTTP API
+// by other services:
+//
+//	find-similar-images serve -addr localhost:8080 dir
+//
+// Instead of walking a directory, images to scan can be listed one per line,
+// or NUL-separated, in a file or on stdin, as find or fd print them:
+//
+//	find photos -newer last-run -name '*.jpg' -print0 | find-similar-images -files -
+//
+// With -watch flag, the directory is scanned again periodically after the
+// initial scan, reporting new images duplicating existing ones as they
+// appear, until the process is interrupted.
+//
+// Images can also be packed into a read-only bundle file, which other
+// programs can load with package github.com/artyom/phash-examples/similar/bundle
+// ("index" is an alias of "pack"):
+//
+//	find-similar-images pack -o index.bundle dir
+//
+// Bundles, of the same or different trees, possibly on different machines,
+// can then be checked for similar images without reading images again:
+//
+//	find-similar-images scan [-across] photos.bundle backup.bundle
+//
+// A single image can be looked up in a -cache database or a bundle, printing
+// nearest images, and exiting with non-zero status if none is similar:
+//
+//	find-similar-images query -index index.db photo.jpg
 package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"flag"
-	"image"
+	"fmt"
+	"hash"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
-	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
+	"time"
 
-	"github.com/artyom/phash"
-	"github.com/disintegration/imaging"
-	"golang.org/x/sync/errgroup"
+	"github.com/artyom/phash-examples/similar"
+	"lukechampine.com/blake3"
 )
 
 func main() {
 	log.SetFlags(0)
+	if os.Getenv("GOMAXPROCS") == "" {
+		// so that decoders running goroutines of their own, and default
+		// number of workers, don't exceed CPU quota of a container
+		runtime.GOMAXPROCS(similar.DefaultWorkers())
+	}
+	if len(os.Args) > 1 {
+		var cmd func([]string) error
+		switch os.Args[1] {
+		case "rethreshold":
+			cmd = rethreshold
+		case "hash":
+			cmd = hashFiles
+		case "undo":
+			cmd = undo
+		case "serve":
+			cmd = serve
+		case "apply-decisions":
+			cmd = applyDecisions
+		case "pack", "index":
+			cmd = pack
+		case "query":
+			cmd = query
+		case "scan":
+			cmd = scanBundles
+		}
+		if cmd != nil {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	args := runArgs{threshold: similar.DefaultThreshold, keep: keepOrder}
+	flag.IntVar(&args.threshold, "threshold", args.threshold,
+		"phash distance similarity threshold (0..64): images with phash distance equal or below it are reported"+
+			" as likely duplicates; 0 only reports identical hashes, higher values tolerate heavier edits and recompression")
+	flag.BoolVar(&args.deterministic, "deterministic", args.deterministic,
+		"process files in sorted order by a single worker, with fixed timestamps, so output is stable between runs")
+	flag.Var(&args.luma, "luma", "grayscale conversion method: 601 (default), 709 or avg")
+	flag.Var(&args.algos, "algo", "hash algorithm: phash (default), dhash, ahash or whash;\n"+
+		"a comma separated list combines them, reporting pairs matched by at least -min-algos of them")
+	flag.IntVar(&args.minAlgos, "min-algos", 2, "with several -algo algorithms, how many of them must match a pair")
+	flag.BoolVar(&args.normalize, "normalize", args.normalize,
+		"equalize histogram before hashing for robustness against brightness/contrast edits (changes hash values)")
+	flag.BoolVar(&args.watermark, "watermark", args.watermark,
+		"ignore corners and bottom strip where watermarks usually are (changes hash values)")
+	flag.BoolVar(&args.rawOrient, "raw-orientation", args.rawOrient,
+		"also match jpeg images ignoring their EXIF orientation, to find copies that lost orientation tag")
+	flag.BoolVar(&args.invariant, "invariant", args.invariant,
+		"also match images rotated by multiples of 90° or mirrored; images are decoded twice")
+	flag.IntVar(&args.tiles, "tiles", args.tiles,
+		"also match partially edited images, like ones with added captions, by hashing `N`×N overlapping tiles\n"+
+			"of each image (0 disables); images are decoded twice")
+	flag.Float64Var(&args.tileVotes, "tile-votes", 0.5, "with -tiles, fraction of tiles of an image that must match those of another one")
+	flag.BoolVar(&args.skipDerived, "skip-derivatives", args.skipDerived,
+		"don't report images likely derived from one another, like IMG_001.jpg and IMG_001_edited.jpg;\n"+
+			"they are reported as derivatives rather than duplicates, and never grouped or acted upon")
+	flag.BoolVar(&args.frames, "frames", args.frames,
+		"also report duplicated frames inside animated gif images")
+	flag.DurationVar(&args.videoInterval, "video-interval", args.videoInterval,
+		"if set, also sample video files every given interval and match images against video frames (requires ffmpeg)")
+	flag.Float64Var(&args.videoCrop, "video-crop-bottom", args.videoCrop,
+		"fraction of video frame height to crop from the bottom before hashing, to ignore burned-in subtitles (e.g. 0.15)")
+	flag.BoolVar(&args.coverArt, "cover-art", args.coverArt,
+		"instead of images, scan mp3/flac/m4a files and report albums with similar embedded cover art")
+	flag.BoolVar(&args.archives, "archives", args.archives,
+		"instead of images, scan .cbz, .cbr and .epub files and report duplicated pages and books")
+	flag.BoolVar(&args.container, "container", args.container,
+		"instead of a directory, scan a container image tarball (docker save, OCI layout) or a directory of layer blobs"+
+			" (containerd content store) and report duplicated images bundled in its layers")
+	flag.BoolVar(&args.git, "git", args.git,
+		"instead of a directory, scan all image blobs in history of git repository and report commits adding near-duplicates"+
+			" (requires git)")
+	flag.StringVar(&args.against, "against", args.against,
+		"reference directory: index its images first, then only report images of the scanned directory similar to them")
+	flag.BoolVar(&args.check, "check", args.check,
+		"check files given after directory (or, if none, listed on stdin) against images in directory,"+
+			" and exit with error if any of them is a near-duplicate; for pre-commit hooks")
+	flag.Float64Var(&args.bookFraction, "book-fraction", 0.8,
+		"with -archives, fraction of pages two books must share to be reported as duplicates")
+	flag.BoolVar(&args.groups, "groups", args.groups,
+		"instead of reporting each similar pair, report groups of similar images at the end, with EXIF metadata,"+
+			" the best copy by -keep policy first")
+	flag.Var(&args.keep, "keep",
+		"comma separated criteria choosing the best copy of a group, which -action keeps, first one taking precedence:\n"+
+			"resolution (largest), size (largest file), oldest (modification time) or gps (has location in EXIF)")
+	flag.StringVar(&args.action, "action", args.action,
+		"act on duplicate groups, keeping the best image by -keep policy:\n"+
+			"move others to -quarantine directory, replace them with hardlinks to it, or delete them;\n"+
+			"rename-canonical leaves others alone and renames the kept image according to -rename-scheme")
+	flag.StringVar(&args.renameScheme, "rename-scheme", "{date}-{hash}{ext}",
+		"with -action=rename-canonical, new name of kept images in their directories, where {date} is their\n"+
+			"modification date, {hash} their hash, {name} and {ext} original name without extension and extension")
+	flag.StringVar(&args.quarantine, "quarantine", args.quarantine, "directory to move duplicates to with -action=move")
+	flag.StringVar(&args.manifest, "manifest", "undo.jsonl", "file to append actions taken with -action to, for \"undo\" subcommand")
+	flag.StringVar(&args.decisions, "decisions", args.decisions,
+		"with -action, write planned actions to this file (csv if it has .csv extension, json lines otherwise)\n"+
+			"instead of performing them, to replay on another copy of the tree with \"apply-decisions\" subcommand")
+	flag.BoolVar(&args.dryRun, "dry-run", args.dryRun, "with -action, only report what would be done")
+	flag.StringVar(&args.html, "html", args.html,
+		"write html page with thumbnails of each group of similar images, for visual review, to this file")
+	flag.StringVar(&args.heatmap, "heatmap", args.heatmap,
+		"write png image of pairwise distances between all images, ordered by groups, to this file")
+	flag.IntVar(&args.videos, "videos", args.videos,
+		"instead of matching images, compare video files with each other by this many evenly spaced frames (requires ffmpeg)")
+	flag.Float64Var(&args.videoDist, "video-threshold", similar.DefaultThreshold,
+		"with -videos, largest mean distance between corresponding frames of similar videos")
+	flag.BoolVar(&args.scenes, "scenes", args.scenes,
+		"instead of matching all images, treat images of each directory as video frames ordered by name"+
+			" and report runs of similar consecutive frames as scenes")
+	flag.Float64Var(&args.dirSimilarity, "dirs", args.dirSimilarity,
+		"if set, also report directories sharing at least this estimated fraction of identical image hashes (e.g. 0.5)")
+	flag.StringVar(&args.cache, "cache", args.cache,
+		"database file to keep image hashes in, so that unchanged files are not hashed again on later runs")
+	flag.StringVar(&args.checkpoint, "checkpoint", args.checkpoint,
+		"periodically save hashes of files scanned so far to this file, so an interrupted scan can be continued with -resume")
+	flag.DurationVar(&args.saveEvery, "checkpoint-every", 30*time.Second, "how often to save -checkpoint file")
+	flag.BoolVar(&args.resume, "resume", args.resume,
+		"with -checkpoint, don't hash files already saved there (unless they changed), and keep adding to it")
+	flag.StringVar(&args.badFiles, "bad-files", args.badFiles,
+		"file to remember images that failed to decode in, so they are skipped on later runs until changed")
+	flag.BoolVar(&args.retryBad, "retry-bad", args.retryBad, "with -bad-files, forget previous failures and retry all files")
+	flag.BoolVar(&args.keepGoing, "keep-going", args.keepGoing,
+		"skip files that fail to be read or decoded instead of stopping, and list them at the end;\n"+
+			"exit status is then only non-zero on errors not specific to a file")
+	flag.IntVar(&args.maxPixels, "max-pixels", args.maxPixels,
+		"if set, skip images of more pixels than this (e.g. 100000000), as decoding them takes too much memory;\n"+
+			"with -keep-going they are listed at the end")
+	flag.BoolVar(&args.scaledDecode, "scaled-decode", args.scaledDecode,
+		"decode jpeg images of at least 2048 pixels on each side at 1/8 of their size, taking a fraction of memory and time;\n"+
+			"their hashes may differ from full size decoded ones by a bit or two, so they are cached separately")
+	flag.Var(&args.memLimit, "mem-limit",
+		"soft memory limit for the Go runtime, like 512MiB or 2G, as with GOMEMLIMIT; also reduces default -workers\n"+
+			"and -lookahead, so that images decoded at once fit in half of it")
+	flag.BoolVar(&args.salvage, "salvage", args.salvage,
+		"hash decodable part of truncated jpeg images instead of failing on them")
+	flag.BoolVar(&args.repair, "repair", args.repair,
+		"implies -salvage, report intact copies of corrupt jpeg files at the end")
+	flag.BoolVar(&args.stats, "stats", args.stats, "print timing and memory usage summary at the end")
+	flag.DurationVar(&args.watch, "watch", args.watch,
+		"after scanning directory, keep scanning it again this often for new and changed images, until interrupted;\n"+
+			"reports at the end, like -groups, are made once interrupted")
+	flag.BoolVar(&args.estimate, "estimate", args.estimate,
+		"instead of scanning, count images and their size, hash a few of them, and print projected scan duration and memory use")
+	flag.DurationVar(&args.progress, "progress", args.progress,
+		"if set, print number of files discovered, scanned and failed, scan rate and ETA this often,\n"+
+			"and a summary of duplicate groups found and bytes reclaimable at the end")
+	flag.Var(&args.workers, "workers", "number of images to process concurrently, or \"auto\" to adjust it while scanning"+
+		" (default is the number of CPUs, or CPU quota of the container if lower)")
+	flag.Var(&args.exclude, "exclude",
+		"skip files and directories matching this glob pattern: patterns without a slash match base names,\n"+
+			"others paths relative to the scanned directory; trailing slash only matches directories; can be repeated.\n"+
+			"Patterns are also read from "+similar.IgnoreFile+" files in scanned directories")
+	flag.IntVar(&args.maxDepth, "max-depth", -1, "if not negative, how many directory levels to descend, 0 only scans files of the directory itself")
+	flag.IntVar(&args.lookahead, "lookahead", -1,
+		"number of discovered files that may wait for processing before directory walk pauses (default is twice the number of workers)")
+	flag.StringVar(&args.spillDir, "spill-dir", args.spillDir,
+		"once -lookahead files are waiting, keep further discovered files in a temporary file in this directory instead of pausing walk")
+	flag.Var(&args.order, "order",
+		"order to hash files in: walk (default, as found), size-desc (largest first), mtime-desc (newest first) or random;\n"+
+			"all but walk list the whole tree before hashing the first file")
+	flag.BoolVar(&args.spotlight, "spotlight", args.spotlight,
+		"instead of walking directory, ask macOS Spotlight for images in it (requires mdfind); faster, but skips files Spotlight doesn't index")
+	flag.StringVar(&args.files, "files", args.files,
+		"instead of walking directory, scan images listed in this file (- for stdin), one per line or NUL-separated;"+
+			" directory argument is then only used for reporting relative paths and defaults to current directory")
+	flag.BoolVar(&args.bulkStat, "bulk-stat", args.bulkStat,
+		"only get attributes of files that may be images, several at a time, while listing directories;\n"+
+			"speeds up discovery on network file systems (NFS, SMB)")
+	flag.BoolVar(&args.mmap, "mmap", args.mmap, "map image files into memory instead of reading them, can be faster on local SSDs")
+	flag.DurationVar(&args.settle, "settle", args.settle,
+		"if set, only hash files not modified for at least this long, waiting for recently changed ones")
+	flag.StringVar(&args.report, "report", args.report,
+		"write report to this file instead of stderr; file only appears once the run completes successfully")
+	flag.StringVar(&args.partial, "partial", args.partial,
+		"append matches found so far to this file as json lines every -partial-every, so a crashed scan doesn't lose them")
+	flag.DurationVar(&args.partialEvery, "partial-every", 5*time.Minute, "how often to append matches to -partial file")
+	flag.StringVar(&args.rewriteMap, "rewrite-map", args.rewriteMap,
+		"write tab-separated mapping of duplicate image paths to their canonical copies to this file,"+
+			" for rewriting references in a static site build")
+	flag.StringVar(&args.format, "format", "text",
+		"format of image match reports: text; github to print GitHub Actions warning annotations;"+
+			" json (one object per line) or csv records of image matches; all but text are written to stdout")
+	flag.StringVar(&args.format, "output", "text", "deprecated alias of -format")
+	flag.StringVar(&args.outputDir, "output-dir", args.outputDir,
+		"write report to a timestamped file in this directory, overrides -report")
+	flag.StringVar(&args.checksum, "checksum", args.checksum, "report checksum of each file content: sha256 or blake3")
 	flag.Parse()
-	if err := run(flag.Arg(0)); err != nil {
+	args.dir = flag.Arg(0)
+	if args.dir == "" && args.files != "" {
+		args.dir = "."
+	}
+	if args.check && flag.NArg() > 1 {
+		args.checkNames = flag.Args()[1:]
+	}
+	if err := run(args); err != nil {
 		log.Fatal(err)
 	}
 }
 
-// minDiff is a phash distance similarity threshold: phash distance above this
-// threshold are treated as different images, images with phash distance equal
-// or below this threshold are reported as likely duplicates
-const minDiff = 5
+type runArgs struct {
+	dir           string
+	threshold     int
+	deterministic bool
+	luma          similar.Luma
+	algos         algorithms
+	minAlgos      int
+	normalize     bool
+	watermark     bool
+	rawOrient     bool
+	skipDerived   bool
+	invariant     bool
+	tiles         int
+	tileVotes     float64
+	frames        bool
+	videoInterval time.Duration
+	videoCrop     float64
+	coverArt      bool
+	archives      bool
+	container     bool
+	git           bool
+	check         bool
+	against       string
+	checkNames    []string
+	bookFraction  float64
+	dirSimilarity float64
+	groups        bool
+	action        string
+	quarantine    string
+	manifest      string
+	dryRun        bool
+	decisions     string
+	renameScheme  string
+	heatmap       string
+	html          string
+	scenes        bool
+	videos        int
+	videoDist     float64
+	cache         string
+	checkpoint    string
+	saveEvery     time.Duration
+	partial       string
+	partialEvery  time.Duration
+	resume        bool
+	badFiles      string
+	retryBad      bool
+	salvage       bool
+	keepGoing     bool
+	maxPixels     int
+	scaledDecode  bool
+	memLimit      byteSize
+	keep          keepPolicy
+	repair        bool
+	stats         bool
+	progress      time.Duration
+	estimate      bool
+	watch         time.Duration
+	workers       workers
+	lookahead     int
+	exclude       globs
+	maxDepth      int
+	spillDir      string
+	mmap          bool
+	bulkStat      bool
+	spotlight     bool
+	files         string
+	order         similar.Order
+	settle        time.Duration
+	report        string
+	outputDir     string
+	format        string
+	rewriteMap    string
+	checksum      string
+}
 
-func run(dir string) error {
-	dups := &duptrack{}
-	group, ctx := errgroup.WithContext(context.Background())
-	ch := make(chan string)
-	walkFunc := func(p string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.Mode().IsRegular() {
-			return nil
-		}
-		if ext := filepath.Ext(p); !(strings.EqualFold(ext, ".jpg") || strings.EqualFold(ext, ".jpeg")) {
-			return nil
-		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case ch <- p:
-		}
+// algo returns the only hash algorithm set by -algo flag, or the default one
+func (args runArgs) algo() similar.Algorithm {
+	if len(args.algos) == 0 {
+		return similar.PHash
+	}
+	return args.algos[0]
+}
+
+// workers is a flag.Value holding either a number of workers, or "auto"
+type workers struct {
+	n    int
+	auto bool
+	max  int // with auto, if set, see -mem-limit
+}
+
+func (w *workers) String() string {
+	if w.auto {
+		return "auto"
+	}
+	return strconv.Itoa(w.n)
+}
+
+func (w *workers) Set(s string) error {
+	if s == "auto" {
+		w.n, w.auto = 0, true
 		return nil
 	}
-	group.Go(func() error {
-		defer close(ch)
-		return filepath.Walk(dir, walkFunc)
-	})
-	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
-		group.Go(func() error {
-			for p := range ch {
-				if err := dups.scan(p); err != nil {
-					return err
-				}
-			}
-			return nil
-		})
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return errors.New("must be a positive number or \"auto\"")
 	}
-	return group.Wait()
+	w.n, w.auto = n, false
+	return nil
 }
 
-type duptrack struct {
-	mu sync.Mutex
-	ms []meta
+// globs is a flag.Value collecting glob patterns of repeated flag
+type globs []string
+
+func (g *globs) String() string { return strings.Join(*g, ", ") }
+
+func (g *globs) Set(s string) error {
+	if _, err := filepath.Match(s, ""); err != nil {
+		return err
+	}
+	*g = append(*g, s)
+	return nil
 }
 
-func (d *duptrack) scan(p string) error {
-	f, err := os.Open(p)
+func run(args runArgs) error {
+	if args.threshold < 0 || args.threshold > 64 {
+		return errors.New("-threshold must be in 0..64 range")
+	}
+	if args.saveEvery <= 0 || args.partialEvery <= 0 {
+		return errors.New("-checkpoint-every and -partial-every must be positive")
+	}
+	if args.tiles < 0 || args.tiles == 1 {
+		return errors.New("-tiles must be at least 2, or 0 to disable tiles")
+	}
+	if args.tiles > 0 && (args.tileVotes <= 0 || args.tileVotes > 1) {
+		return errors.New("-tile-votes must be in (0, 1] range")
+	}
+	switch args.action {
+	case "":
+	case "move":
+		if args.quarantine == "" && args.decisions == "" {
+			return errors.New("-action=move requires -quarantine directory")
+		}
+	case "hardlink", "delete":
+	case "rename-canonical":
+		if args.decisions != "" {
+			return errors.New("-decisions doesn't support -action=rename-canonical")
+		}
+		if args.renameScheme == "" || strings.ContainsAny(args.renameScheme, `/\`) {
+			return errors.New("-rename-scheme must be a non-empty file name")
+		}
+	default:
+		return fmt.Errorf("unsupported -action value %q", args.action)
+	}
+	if args.decisions != "" && args.action == "" {
+		return errors.New("-decisions requires -action")
+	}
+	if args.action != "" && (args.archives || args.container || args.git || args.scenes || args.videos > 0 || len(args.algos) > 1 ||
+		args.coverArt || args.against != "" || args.check) {
+		return errors.New("-action only works with plain directory scans")
+	}
+	if args.files != "" && (args.archives || args.container || args.git || args.scenes || args.videos > 0 ||
+		args.coverArt || args.against != "" || args.check || args.estimate || args.spotlight || args.watch > 0) {
+		return errors.New("-files only works with plain directory scans")
+	}
+	if args.memLimit > 0 {
+		applyMemLimit(&args)
+	}
+	keepOrder = args.keep
+	switch args.format {
+	case "text":
+	case "github", "json", "csv":
+		reportFormat = args.format
+		report.SetOutput(os.Stdout)
+		defer report.SetOutput(os.Stderr)
+	default:
+		return fmt.Errorf("unsupported -format value %q", args.format)
+	}
+	if structuredFormat() && (args.archives || args.container || args.git || args.coverArt || args.scenes || args.videos > 0 ||
+		args.frames || args.dirSimilarity > 0 || args.repair) {
+		return fmt.Errorf("-format %s only works with reports of image matches", args.format)
+	}
+	if args.deterministic {
+		now = func() time.Time { return time.Time{} }
+	}
+	name := reportName(args)
+	if name == "" {
+		return scan(args)
+	}
+	f, err := createAtomic(name)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	img, err := imaging.Decode(f, imaging.AutoOrientation(true))
-	if err != nil {
+	report.SetOutput(f)
+	defer report.SetOutput(os.Stderr)
+	if err := scan(args); err != nil {
+		f.Abort()
 		return err
 	}
-	x, err := phash.Get(img, func(img image.Image, w, h int) image.Image {
-		return imaging.Resize(img, w, h, imaging.Lanczos)
+	return f.Commit()
+}
+
+func scan(args runArgs) (err error) {
+	opts := []similar.Option{
+		similar.WithThreshold(args.threshold),
+		similar.WithLuma(args.luma),
+		similar.WithAlgorithm(args.algo()),
+	}
+	if args.normalize {
+		opts = append(opts, similar.WithNormalize())
+	}
+	if args.watermark {
+		opts = append(opts, similar.WithWatermarkMask())
+	}
+	if args.rawOrient {
+		opts = append(opts, similar.WithRawOrientation())
+	}
+	if args.invariant {
+		opts = append(opts, similar.WithInvariant())
+	}
+	if args.tiles > 0 {
+		opts = append(opts, similar.WithTiles(args.tiles, args.tileVotes))
+	}
+	if args.videoInterval > 0 {
+		opts = append(opts, similar.WithVideoFrames(args.videoInterval))
+	}
+	if args.videoCrop > 0 {
+		opts = append(opts, similar.WithVideoCropBottom(args.videoCrop))
+	}
+	switch {
+	case args.workers.auto && args.workers.max > 0:
+		opts = append(opts, similar.WithAutoWorkers(args.workers.max))
+	case args.workers.auto:
+		opts = append(opts, similar.WithAutoWorkers(8*runtime.GOMAXPROCS(0)))
+	case args.workers.n > 0:
+		opts = append(opts, similar.WithWorkers(args.workers.n))
+	}
+	switch args.checksum {
+	case "":
+	case "sha256":
+		opts = append(opts, similar.WithChecksum(sha256.New))
+	case "blake3":
+		opts = append(opts, similar.WithChecksum(func() hash.Hash { return blake3.New(32, nil) }))
+	default:
+		return fmt.Errorf("unsupported checksum %q", args.checksum)
+	}
+	checksumName = args.checksum
+	hashName = args.algo().String()
+	if args.lookahead >= 0 {
+		opts = append(opts, similar.WithLookahead(args.lookahead))
+	}
+	if len(args.exclude) > 0 {
+		opts = append(opts, similar.WithExclude(args.exclude...))
+	}
+	if args.maxDepth >= 0 {
+		opts = append(opts, similar.WithMaxDepth(args.maxDepth))
+	}
+	if args.spillDir != "" {
+		opts = append(opts, similar.WithSpillDir(args.spillDir))
+	}
+	if args.mmap {
+		opts = append(opts, similar.WithMmap())
+	}
+	if args.maxPixels > 0 {
+		opts = append(opts, similar.WithMaxPixels(args.maxPixels))
+	}
+	if args.scaledDecode {
+		opts = append(opts, similar.WithScaledDecode())
+	}
+	if args.bulkStat {
+		opts = append(opts, similar.WithBulkStat())
+	}
+	if args.spotlight {
+		opts = append(opts, similar.WithSpotlight())
+	}
+	if args.files != "" {
+		f := os.Stdin
+		if args.files != "-" {
+			var err error
+			if f, err = os.Open(args.files); err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+		opts = append(opts, similar.WithFileList(f))
+	}
+	if args.order != similar.OrderWalk {
+		opts = append(opts, similar.WithOrder(args.order))
+	}
+	if args.settle > 0 {
+		opts = append(opts, similar.WithSettleTime(args.settle))
+	}
+	if args.salvage || args.repair {
+		opts = append(opts, similar.WithSalvage())
+	}
+	if args.deterministic {
+		opts = append(opts, similar.WithDeterministic())
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if args.workers.n > 0 {
+		workers = args.workers.n
+	}
+	if args.deterministic {
+		workers = 1
+	}
+	if args.estimate {
+		return estimate(args.dir, workers, opts)
+	}
+	if args.archives {
+		return reportArchives(args.dir, args.threshold, workers, args.bookFraction, opts)
+	}
+	if args.container {
+		return reportContainerImage(args.dir, args.threshold, opts)
+	}
+	if args.git {
+		return reportGitHistory(args.dir, args.threshold, opts)
+	}
+	if len(args.algos) > 1 {
+		var onError func(string, error)
+		if args.keepGoing {
+			var skipped fileErrors
+			defer skipped.report()
+			onError = skipped.add
+		}
+		return reportCombined(args.dir, args.algos, args.minAlgos, args.threshold, onError, opts)
+	}
+	if args.videos > 0 {
+		return reportVideos(args.dir, args.videos, args.videoDist, workers, opts)
+	}
+	if args.scenes {
+		return reportScenes(args.dir, args.threshold, opts)
+	}
+	if args.coverArt {
+		return reportCoverArt(args.dir, args.threshold, opts)
+	}
+	var cs caches
+	if args.cache != "" {
+		cache, err := similar.OpenBoltCache(args.cache, cacheBucket(args.algo(), args.luma, args.normalize, args.watermark, args.scaledDecode))
+		if err != nil {
+			return err
+		}
+		defer cache.Close()
+		cs = append(cs, cache)
+	}
+	if args.checkpoint != "" {
+		var cp *similar.Checkpoint
+		cp, err = similar.OpenCheckpoint(args.checkpoint, cacheBucket(args.algo(), args.luma, args.normalize, args.watermark, args.scaledDecode), args.resume)
+		if err != nil {
+			return err
+		}
+		if args.resume {
+			log.Printf("resuming, %d files already hashed", cp.Len())
+		}
+		stop := flushPeriodically(cp, "checkpoint", args.saveEvery)
+		defer func() {
+			if cerr := stop(); err == nil {
+				err = cerr
+			}
+		}()
+		cs = append(cs, cp)
+	}
+	switch len(cs) {
+	case 0:
+	case 1:
+		opts = append(opts, similar.WithCache(cs[0]))
+	default:
+		opts = append(opts, similar.WithCache(cs))
+	}
+	if args.badFiles != "" {
+		if args.retryBad {
+			if err := os.Remove(args.badFiles); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		fl, err := similar.OpenFailureLog(args.badFiles)
+		if err != nil {
+			return err
+		}
+		defer fl.Close()
+		opts = append(opts, similar.WithFailureCache(fl))
+	}
+	if args.against != "" {
+		return compareAgainst(args.against, args.dir, opts)
+	}
+	if args.check {
+		names := args.checkNames
+		if names == nil {
+			var err error
+			if names, err = readNames(os.Stdin); err != nil {
+				return err
+			}
+		}
+		return check(args.dir, names, opts)
+	}
+	var dirs *dirIndex
+	if args.dirSimilarity > 0 {
+		dirs = &dirIndex{Index: similar.NewIndex(), dirs: make(map[string][]uint64)}
+		opts = append(opts, similar.WithIndex(dirs))
+	}
+	var all *entryIndex
+	if args.heatmap != "" {
+		all = &entryIndex{Index: similar.NewIndex()}
+		if dirs != nil {
+			all.Index = dirs
+		}
+		opts = append(opts, similar.WithIndex(all))
+	}
+	var skipped fileErrors
+	if args.keepGoing {
+		opts = append(opts, similar.WithErrorHandler(skipped.add))
+		defer skipped.report()
+	}
+	s := similar.NewScanner(opts...)
+	defer handlePauseSignals(s)()
+	if args.stats {
+		defer func(start time.Time) { printStats(s.Stats(), time.Since(start)) }(time.Now())
+	}
+	if args.progress > 0 {
+		defer reportProgress(s, args.progress)()
+	}
+	repairs := &repairTracker{best: make(map[string]similar.Match)}
+	rewrites := &rewriteMap{canonical: make(map[string]string)}
+	groups := &groupTracker{ids: make(map[string]int)}
+	var clusters similar.Groups
+	var partial *partialFile
+	if args.partial != "" {
+		if partial, err = openPartial(args.partial); err != nil {
+			return err
+		}
+		stop := flushPeriodically(partial, "partial", args.partialEvery)
+		defer func() {
+			if cerr := stop(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+	ctx, scan := context.Background(), s.Scan
+	if args.watch > 0 {
+		var stop func()
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		scan = func(ctx context.Context, dir string, fn func(similar.Pair)) error {
+			return s.Watch(ctx, dir, args.watch, fn)
+		}
+	}
+	err = scan(ctx, args.dir, func(p similar.Pair) {
+		if partial != nil && (!args.skipDerived || !derivative(p.Name, p.Match.Name)) {
+			partial.add(pairRecord(p, 0))
+		}
+		if derivative(p.Name, p.Match.Name) {
+			if !args.skipDerived {
+				reportPair(p, groups)
+			}
+			return
+		}
+		repairs.add(p)
+		rewrites.add(p)
+		if args.groups || args.action != "" || args.heatmap != "" || args.html != "" || args.progress > 0 {
+			clusters.Add(p)
+			if args.groups {
+				return
+			}
+		}
+		reportPair(p, groups)
 	})
 	if err != nil {
 		return err
 	}
-	info := meta{hash: x, name: p}
-
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	i := sort.Search(len(d.ms), func(i int) bool { return d.ms[i].hash >= info.hash })
-	if i == len(d.ms) {
-		if i != 0 {
-			info2 := d.ms[i-1]
-			if diff := phash.Distance(info.hash, info2.hash); diff <= minDiff {
-				log.Printf("close match: %q has phash close (%x, dist=%d) to %q", p, info.hash, diff, info2.name)
-			}
+	if args.groups {
+		reportGroups(&clusters)
+	}
+	if args.progress > 0 {
+		printSummary(s.Stats(), &clusters, args.threshold)
+	}
+	if args.html != "" {
+		if err := writeHTML(args.html, &clusters); err != nil {
+			return err
 		}
-		d.ms = append(d.ms, info)
-		return nil
 	}
-	if d.ms[i].hash == info.hash {
-		log.Printf("possible duplicate: %q has the same phash (%x) as %q", p, info.hash, d.ms[i].name)
-		return nil
+	if all != nil {
+		if err := writeHeatmap(args.heatmap, all.entries, &clusters); err != nil {
+			return err
+		}
+	}
+	if args.action != "" {
+		if err := applyAction(&clusters, args); err != nil {
+			return err
+		}
+	}
+	if args.repair {
+		repairs.report()
 	}
-	// the index is [i] here, and not [i+1], because this check is *before*
-	// info is inserted into slice, so an element that would be to its right is
-	// still at position [i]
-	info2 := d.ms[i]
-	if diff := phash.Distance(info.hash, info2.hash); diff <= minDiff {
-		log.Printf("close match: %q has phash close (%x, dist=%d) to %q", p, info.hash, diff, info2.name)
+	if dirs != nil {
+		dirs.report(args.dirSimilarity)
 	}
-	if i > 0 {
-		info2 = d.ms[i-1]
-		if diff := phash.Distance(info.hash, info2.hash); diff <= minDiff {
-			log.Printf("close match: %q has phash close (%x, dist=%d) to %q", p, info.hash, diff, info2.name)
+	if args.rewriteMap != "" {
+		if err := rewrites.write(args.rewriteMap, args.dir); err != nil {
+			return err
 		}
 	}
-
-	ms2 := d.ms[:i+1]
-	tail := make([]meta, len(d.ms[i:]))
-	copy(tail, d.ms[i:])
-	ms2[i] = info
-	d.ms = append(ms2, tail...)
+	if args.frames {
+		return reportFrames(args.dir, opts)
+	}
 	return nil
 }
 
-type meta struct {
-	hash uint64
-	name string
+// reportPair reports a match found by scan in the format set by -format flag
+func reportPair(p similar.Pair, groups *groupTracker) {
+	if structuredFormat() {
+		writeRecord(pairRecord(p, groups.add(p)))
+		return
+	}
+	var raw string
+	hash := p.Hash // of the newly scanned image, as compared
+	if p.RawOrientation != "" {
+		raw = fmt.Sprintf(", ignoring EXIF orientation of %q", p.RawOrientation)
+	}
+	if p.Transform != "" {
+		raw += fmt.Sprintf(", after %s was %s", describe(p.Entry), p.Transform)
+	}
+	if p.Transform != "" || p.RawOrientation == p.Name {
+		hash = p.MatchedHash
+	}
+	if p.Tiles > 0 {
+		raw += fmt.Sprintf(", by %d matching tiles", p.Tiles)
+	}
+	if derivative(p.Name, p.Match.Name) {
+		reportFinding(p.Name, "derivative: %s is likely derived from %s (phash %x, dist=%d)%s", describe(p.Entry), describe(p.Match.Entry), hash, p.Match.Distance, raw)
+		return
+	}
+	if p.Match.Distance == 0 {
+		reportFinding(p.Name, "possible duplicate: %s has the same %s (%x) as %s%s", describe(p.Entry), hashName, hash, describe(p.Match.Entry), raw)
+		return
+	}
+	reportFinding(p.Name, "close match: %s has %s close (%x, dist=%d) to %s%s", describe(p.Entry), hashName, hash, p.Match.Distance, describe(p.Match.Entry), raw)
+}
+
+// pairRecord returns record of a match found by scan
+func pairRecord(p similar.Pair, group int) record {
+	r := newRecord(p.Entry, p.Match.Entry, p.Match.Distance, group)
+	r.RawOrientation = p.RawOrientation
+	r.Transform = p.Transform
+	r.Tiles = p.Tiles
+	if p.RawOrientation != "" || p.Transform != "" {
+		r.MatchedHash = fmt.Sprintf("%016x", p.MatchedHash)
+	}
+	r.Derivative = derivative(p.Name, p.Match.Name)
+	return r
+}
+
+// cacheBucket returns name of -cache database bucket to keep hashes computed
+// with given options in: options changing hash values select a separate set
+// of cached hashes. It also records these options in decisions, see
+// hashingOptions.
+func cacheBucket(algo similar.Algorithm, luma similar.Luma, normalize, watermark, scaled bool) string {
+	bucket := algo.String() + " luma=" + luma.String()
+	if normalize {
+		bucket += " normalize"
+	}
+	if watermark {
+		bucket += " watermark"
+	}
+	if scaled {
+		bucket += " scaled"
+	}
+	return bucket
+}
+
+// hashName is the name of hash algorithm used, as set by -algo flag
+var hashName = similar.PHash.String()
+
+// checksumName is the name of checksum algorithm used, as set by -checksum
+// flag
+var checksumName string
+
+// describe returns quoted entry name, followed by its checksum if any, and
+// marked if image was only partially decoded
+func describe(e similar.Entry) string {
+	s := fmt.Sprintf("%q", e.Name)
+	if e.Checksum != nil {
+		s += fmt.Sprintf(" (%s %x)", checksumName, e.Checksum)
+	}
+	if e.Salvaged {
+		s += " (partially decoded)"
+	}
+	return s
+}
+
+// reportFrames walks dir looking for gif images, and reports animation frames
+// that duplicate earlier frames of the same image.
+func reportFrames(dir string, opts []similar.Option) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !strings.EqualFold(filepath.Ext(p), ".gif") {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		ms, err := similar.DuplicateFrames(f, opts...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		for _, m := range ms {
+			report.Printf("duplicate frame: %q frame %d is close (dist=%d) to frame %d", p, m.Frame, m.Distance, m.Earlier)
+		}
+		return nil
+	})
 }
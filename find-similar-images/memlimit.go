@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// byteSize is a flag.Value holding a number of bytes, which may have KiB, MiB
+// or GiB suffix (K, M and G are the same)
+type byteSize int64
+
+func (b *byteSize) String() string {
+	switch n := int64(*b); {
+	case n != 0 && n%(1<<30) == 0:
+		return fmt.Sprintf("%dGiB", n>>30)
+	case n != 0 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", n>>20)
+	}
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	mult := int64(1)
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "IB"), "B")
+	switch {
+	case strings.HasSuffix(num, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(num, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(num, "G"):
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		num = num[:len(num)-1]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return errors.New("must be a number of bytes, like 512MiB or 2G")
+	}
+	*b = byteSize(n * mult)
+	return nil
+}
+
+// workerMemory is the memory a worker is assumed to need without -max-pixels,
+// enough to decode a 16 megapixel photo
+const workerMemory = 64 << 20
+
+// applyMemLimit sets Go runtime soft memory limit to -mem-limit, and reduces
+// the number of workers, unless set explicitly, and -lookahead, unless set,
+// so that images decoded at once take at most half of the limit. The other
+// half is left for the index and garbage collector.
+func applyMemLimit(args *runArgs) {
+	limit := int64(args.memLimit)
+	debug.SetMemoryLimit(limit)
+	perWorker := int64(workerMemory)
+	if args.maxPixels > 0 {
+		perWorker = 4 * int64(args.maxPixels)
+	}
+	fit := int(limit / 2 / perWorker)
+	if fit < 1 {
+		fit = 1
+	}
+	n := runtime.GOMAXPROCS(0)
+	switch {
+	case args.workers.n > 0:
+		if n = args.workers.n; n > fit {
+			log.Printf("-workers=%d may need more than half of -mem-limit=%s", n, &args.memLimit)
+		}
+	case args.workers.auto:
+		n = min(fit, 8*n)
+		args.workers.max = n
+	case fit < n:
+		n = fit
+		args.workers.n = n
+	}
+	if args.lookahead < 0 {
+		args.lookahead = n
+	}
+}
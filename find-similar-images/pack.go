@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/artyom/phash-examples/similar"
+	"github.com/artyom/phash-examples/similar/bundle"
+)
+
+// pack implements "pack" subcommand: it hashes images under a directory,
+// found the same way scan finds them, and writes them to a read-only bundle
+// file, see package bundle. Names are slash separated paths relative to the
+// directory, and bundle metadata describes hash settings, in the same form
+// as -cache database bucket names.
+func pack(argv []string) error {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: find-similar-images pack [flags] dir")
+		fs.PrintDefaults()
+	}
+	out := fs.String("o", "index.bundle", "bundle file to write")
+	var algo similar.Algorithm
+	fs.Var(&algo, "algo", "hash algorithm: phash (default), dhash, ahash or whash")
+	var luma similar.Luma
+	fs.Var(&luma, "luma", "grayscale conversion method: 601 (default), 709 or avg")
+	var exclude globs
+	fs.Var(&exclude, "exclude", "skip files and directories matching this glob pattern, as with the main command; can be repeated")
+	maxDepth := fs.Int("max-depth", -1, "if not negative, how many directory levels to descend")
+	fs.Parse(argv)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := fs.Arg(0)
+	opts := []similar.Option{similar.WithAlgorithm(algo), similar.WithLuma(luma), similar.WithExclude(exclude...)}
+	if *maxDepth >= 0 {
+		opts = append(opts, similar.WithMaxDepth(*maxDepth))
+	}
+	ctx := context.Background()
+	var paths []string
+	err := similar.Walk(ctx, dir, func(p string, _ os.FileInfo) error {
+		paths = append(paths, p)
+		return nil
+	}, append(opts, similar.WithErrorHandler(func(name string, err error) {
+		log.Printf("skipping %q: %v", name, err)
+	}))...)
+	if err != nil {
+		return err
+	}
+	results, err := similar.HashAll(ctx, paths, opts...)
+	if err != nil {
+		return err
+	}
+	var names []string
+	var hashes []uint64
+	for _, r := range results {
+		if r.Err != nil {
+			log.Printf("skipping %q: %v", r.Path, r.Err)
+			continue
+		}
+		rel, err := filepath.Rel(dir, r.Path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		hashes = append(hashes, r.Hash)
+	}
+	f, err := createAtomic(*out)
+	if err != nil {
+		return err
+	}
+	if err := bundle.Write(f, cacheBucket(algo, luma, false, false, false), names, hashes); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Commit(); err != nil {
+		return err
+	}
+	log.Printf("%d images packed to %s", len(names), *out)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// partialFile appends matches as json lines to the -partial file, so that
+// matches found by a long scan are kept if it crashes. Matches are buffered
+// in memory between flushes, and only whole lines are ever written.
+type partialFile struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf bytes.Buffer
+}
+
+func openPartial(name string) (*partialFile, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &partialFile{f: f}, nil
+}
+
+func (p *partialFile) add(r record) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		panic(err) // record only has strings and numbers
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf.Write(b)
+	p.buf.WriteByte('\n')
+}
+
+// Flush appends buffered matches to the file and syncs it to disk.
+func (p *partialFile) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.buf.Len() == 0 {
+		return nil
+	}
+	if _, err := p.f.Write(p.buf.Bytes()); err != nil {
+		return err
+	}
+	p.buf.Reset()
+	return p.f.Sync()
+}
+
+// Close flushes buffered matches and closes the file.
+func (p *partialFile) Close() error {
+	err := p.Flush()
+	if err2 := p.f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
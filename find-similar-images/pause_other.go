@@ -0,0 +1,9 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import "github.com/artyom/phash-examples/similar"
+
+// handlePauseSignals does nothing on platforms without SIGUSR1 and SIGUSR2
+func handlePauseSignals(*similar.Scanner) (stop func()) { return func() {} }
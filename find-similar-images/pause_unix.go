@@ -0,0 +1,44 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// handlePauseSignals pauses scan on SIGUSR1, printing its progress, and
+// resumes it on SIGUSR2. It returns a function that stops signal handling.
+func handlePauseSignals(s *similar.Scanner) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	start := time.Now()
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-sigs:
+				if sig == syscall.SIGUSR1 {
+					s.Pause()
+					printProgress(s.Stats(), time.Since(start))
+					log.Print("paused, send SIGUSR2 to resume")
+				} else {
+					s.Resume()
+					log.Print("resumed")
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar"
+)
+
+// reportProgress logs scanner progress every interval, until returned
+// function is called
+func reportProgress(s *similar.Scanner, interval time.Duration) (stop func()) {
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				printProgress(s.Stats(), time.Since(start))
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// printProgress logs a single line of scan progress: files discovered,
+// scanned and failed, scan rate and estimated time left. Until directory walk
+// completes, the estimate only covers files discovered so far.
+func printProgress(st similar.Stats, elapsed time.Duration) {
+	rate := float64(st.Scanned) / elapsed.Seconds()
+	total := fmt.Sprint(st.Discovered)
+	if !st.WalkDone {
+		total += "+"
+	}
+	eta := "unknown"
+	if rate > 0 {
+		eta = (time.Duration(float64(st.Discovered-st.Scanned)/rate) * time.Second).Round(time.Second).String()
+	}
+	log.Printf("progress: %d of %s files scanned, %d errors, %.1f images/sec, ETA %s",
+		st.Scanned, total, st.Errors, rate, eta)
+}
+
+// printSummary logs totals of the run: images scanned, duplicate groups
+// found, and bytes that would be freed by removing all members of each group
+// within threshold distance of its best image, as -action does.
+func printSummary(st similar.Stats, groups *similar.Groups, threshold int) {
+	var n int
+	var reclaimable int64
+	for _, ms := range sortedGroups(groups) {
+		n++
+		for _, m := range ms[1:] {
+			if phash.Distance(m.Hash, ms[0].Hash) <= threshold {
+				reclaimable += m.Size
+			}
+		}
+	}
+	log.Printf("summary: %d images scanned, %d errors, %d duplicate groups, %.1f MiB reclaimable",
+		st.Scanned, st.Errors, n, float64(reclaimable)/(1<<20))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar"
+	"github.com/artyom/phash-examples/similar/bundle"
+)
+
+// query implements "query" subcommand: it prints images of a prebuilt index
+// nearest to a given image, and returns an error if none of them is within
+// threshold, so that it exits with non-zero status. Index is either a -cache
+// database, or a bundle written by "pack" subcommand.
+func query(argv []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: find-similar-images query -index index.db [flags] image")
+		fs.PrintDefaults()
+	}
+	index := fs.String("index", "", "-cache database or bundle file to look image up in")
+	n := fs.Int("n", 5, "number of nearest images to print")
+	threshold := fs.Int("t", similar.DefaultThreshold, "phash distance threshold for an image to count as a match")
+	var algo similar.Algorithm
+	fs.Var(&algo, "algo", "-algo value index hashes were computed with")
+	var luma similar.Luma
+	fs.Var(&luma, "luma", "-luma value index hashes were computed with")
+	normalize := fs.Bool("normalize", false, "index hashes were computed with -normalize")
+	watermark := fs.Bool("watermark", false, "index hashes were computed with -watermark")
+	scaled := fs.Bool("scaled-decode", false, "index hashes were computed with -scaled-decode")
+	fs.Parse(argv)
+	if fs.NArg() != 1 || *index == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *threshold < 0 || *threshold > 64 {
+		return errors.New("-t must be in 0..64 range")
+	}
+	opts := []similar.Option{similar.WithAlgorithm(algo), similar.WithLuma(luma)}
+	if *normalize {
+		opts = append(opts, similar.WithNormalize())
+	}
+	if *watermark {
+		opts = append(opts, similar.WithWatermarkMask())
+	}
+	if *scaled {
+		opts = append(opts, similar.WithScaledDecode())
+	}
+	hash, err := similar.HashFile(fs.Arg(0), opts...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	tag := cacheBucket(algo, luma, *normalize, *watermark, *scaled)
+	var found []similar.Match
+	if b, err := bundle.Open(*index); err == nil {
+		defer b.Close()
+		if b.Meta() != tag {
+			return fmt.Errorf("%s has hashes computed with %q, not %q", *index, b.Meta(), tag)
+		}
+		for i := 0; i < b.Len(); i++ {
+			h := b.Hash(i)
+			found = append(found, similar.Match{Entry: similar.Entry{Name: b.Name(i), Hash: h},
+				Distance: phash.Distance(h, hash)})
+		}
+	} else if errors.Is(err, bundle.ErrFormat) {
+		cache, err := similar.OpenBoltCache(*index, tag)
+		if err != nil {
+			return err
+		}
+		defer cache.Close()
+		err = cache.Walk(func(name string, _ int64, _ time.Time, h uint64) error {
+			found = append(found, similar.Match{Entry: similar.Entry{Name: name, Hash: h},
+				Distance: phash.Distance(h, hash)})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Distance < found[j].Distance })
+	if len(found) > *n {
+		found = found[:*n]
+	}
+	for _, m := range found {
+		fmt.Printf("%d\t%016x\t%s\n", m.Distance, m.Hash, m.Name)
+	}
+	if len(found) == 0 || found[0].Distance > *threshold {
+		return fmt.Errorf("no image within distance %d of %s", *threshold, fs.Arg(0))
+	}
+	return nil
+}
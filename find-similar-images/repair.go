@@ -0,0 +1,39 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// repairTracker collects matches between partially decoded (salvaged) images
+// and intact ones, keeping the closest intact match for each salvaged image.
+type repairTracker struct {
+	best map[string]similar.Match // key is salvaged image name
+}
+
+func (r *repairTracker) add(p similar.Pair) {
+	damaged, intact := p.Entry, p.Match.Entry
+	if damaged.Salvaged == intact.Salvaged {
+		return
+	}
+	if intact.Salvaged {
+		damaged, intact = intact, damaged
+	}
+	if m, ok := r.best[damaged.Name]; ok && m.Distance <= p.Match.Distance {
+		return
+	}
+	r.best[damaged.Name] = similar.Match{Entry: intact, Distance: p.Match.Distance}
+}
+
+func (r *repairTracker) report() {
+	names := make([]string, 0, len(r.best))
+	for name := range r.best {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := r.best[name]
+		report.Printf("repair: corrupt file %q appears to be a damaged copy of intact file %q (dist=%d)", name, m.Name, m.Distance)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// report is where scan results are written to. It writes to stderr unless
+// -report or -output-dir flags are set.
+var report = log.New(os.Stderr, "", 0)
+
+// reportFinding reports a problem with named file: as is, or, with github
+// format, as GitHub Actions workflow command, so it shows up inline in pull
+// request review.
+func reportFinding(file, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if reportFormat != "github" {
+		report.Print(msg)
+		return
+	}
+	prop := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	data := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	report.Printf("::warning file=%s::%s", prop.Replace(filepath.ToSlash(file)), data.Replace(msg))
+}
+
+// reportStatus reports a line which is not about a particular file, like a
+// summary or an action taken: along with findings, or to stderr if findings
+// are written as records, see structuredFormat.
+func reportStatus(format string, v ...interface{}) {
+	if structuredFormat() {
+		log.Printf(format, v...)
+		return
+	}
+	report.Printf(format, v...)
+}
+
+// now returns current time for timestamps in output; -deterministic fixes it
+// to the zero time.
+var now = time.Now
+
+// reportName returns name of a report file to create, or an empty string if
+// report should go to stderr
+func reportName(args runArgs) string {
+	if args.outputDir != "" {
+		ext := ".txt"
+		switch reportFormat {
+		case "json":
+			ext = ".jsonl"
+		case "csv":
+			ext = ".csv"
+		}
+		name := "find-similar-images-" + now().Format("20060102-150405") + ext
+		return filepath.Join(args.outputDir, name)
+	}
+	return args.report
+}
+
+// atomicFile is a file written under a temporary name, and renamed to its
+// final name only once complete, so that readers never see partially
+// written file.
+type atomicFile struct {
+	*os.File
+	name string
+}
+
+func createAtomic(name string) (*atomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, name: name}, nil
+}
+
+// Commit flushes file to disk and renames it to its final name. Temporary
+// files are created with 0600 permissions, so Commit makes it 0644 first.
+func (f *atomicFile) Commit() error {
+	defer os.Remove(f.File.Name()) // no-op if rename succeeded
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.File.Name(), f.name)
+}
+
+// Abort discards file.
+func (f *atomicFile) Abort() error {
+	f.Close()
+	return os.Remove(f.File.Name())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// rethreshold implements "rethreshold" subcommand: it reports matches
+// between hashes stored in a -cache database at a given threshold, without
+// reading any image files.
+func rethreshold(argv []string) error {
+	fs := flag.NewFlagSet("rethreshold", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: find-similar-images rethreshold [flags] index.db")
+		fs.PrintDefaults()
+	}
+	threshold := fs.Int("t", similar.DefaultThreshold, "phash distance threshold")
+	var algo similar.Algorithm
+	fs.Var(&algo, "algo", "-algo value hashes were computed with")
+	var luma similar.Luma
+	fs.Var(&luma, "luma", "-luma value hashes were computed with")
+	normalize := fs.Bool("normalize", false, "select hashes computed with -normalize")
+	watermark := fs.Bool("watermark", false, "select hashes computed with -watermark")
+	scaled := fs.Bool("scaled-decode", false, "select hashes computed with -scaled-decode")
+	format := fs.String("format", "text", "format of reports: text, github, json or csv")
+	fs.Parse(argv)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *threshold < 0 || *threshold > 64 {
+		return errors.New("-t must be in 0..64 range")
+	}
+	switch *format {
+	case "text":
+	case "github", "json", "csv":
+		reportFormat = *format
+		report.SetOutput(os.Stdout)
+		defer report.SetOutput(os.Stderr)
+	default:
+		return fmt.Errorf("unsupported -format value %q", *format)
+	}
+	hashName = algo.String()
+	name := fs.Arg(0)
+	if _, err := os.Stat(name); err != nil {
+		return err // don't let OpenBoltCache create a new database
+	}
+	cache, err := similar.OpenBoltCache(name, cacheBucket(algo, luma, *normalize, *watermark, *scaled))
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+	idx := similar.NewIndex()
+	groups := &groupTracker{ids: make(map[string]int)}
+	return cache.Walk(func(name string, _ int64, _ time.Time, hash uint64) error {
+		e := similar.Entry{Name: name, Hash: hash}
+		for _, m := range idx.Search(hash, *threshold) {
+			reportPair(similar.Pair{Entry: e, Match: m}, groups)
+		}
+		idx.Add(e)
+		return nil
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// rewriteMap maps duplicate images to a canonical copy: the first scanned
+// image of a set of similar ones.
+type rewriteMap struct {
+	canonical map[string]string // duplicate name to canonical name
+}
+
+func (r *rewriteMap) add(p similar.Pair) {
+	if _, ok := r.canonical[p.Name]; ok {
+		return
+	}
+	target := p.Match.Name
+	if c, ok := r.canonical[target]; ok {
+		target = c
+	}
+	r.canonical[p.Name] = target
+}
+
+// write saves mapping to named file as tab-separated "old path", "canonical
+// path" lines, paths are relative to dir and slash-separated, so that build
+// tools can use them to rewrite references. It then reports the total size
+// of duplicates, which is what rewriting would save in transfer.
+func (r *rewriteMap) write(name, dir string) error {
+	names := make([]string, 0, len(r.canonical))
+	for name := range r.canonical {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	f, err := createAtomic(name)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	w := bufio.NewWriter(f)
+	var saved int64
+	for _, p := range names {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		saved += fi.Size()
+		old, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		canonical, err := filepath.Rel(dir, r.canonical[p])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\n", filepath.ToSlash(old), filepath.ToSlash(canonical))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Commit(); err != nil {
+		return err
+	}
+	reportStatus("rewrite map: %d duplicate images, rewriting references to them would save up to %d bytes of transfer",
+		len(names), saved)
+	return nil
+}
@@ -0,0 +1,12 @@
+package main
+
+import "syscall"
+
+// peakRSS returns maximum resident set size of the process in bytes
+func peakRSS() int64 {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return ru.Maxrss // reported in bytes
+}
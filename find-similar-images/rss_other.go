@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+// peakRSS returns 0 on platforms where peak resident set size is not
+// available
+func peakRSS() int64 { return 0 }
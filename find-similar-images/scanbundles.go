@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/artyom/phash-examples/similar"
+	"github.com/artyom/phash-examples/similar/bundle"
+)
+
+// scanBundles implements "scan" subcommand: it reports similar images within
+// and across bundles written by "pack" subcommand, without reading any image
+// files. With several bundles, names are prefixed with bundle file name.
+func scanBundles(argv []string) error {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: find-similar-images scan [flags] index.bundle...")
+		fs.PrintDefaults()
+	}
+	threshold := fs.Int("t", similar.DefaultThreshold, "phash distance threshold")
+	across := fs.Bool("across", false, "only report similar images from different bundles")
+	format := fs.String("format", "text", "format of reports: text, github, json or csv")
+	fs.Parse(argv)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *threshold < 0 || *threshold > 64 {
+		return errors.New("-t must be in 0..64 range")
+	}
+	switch *format {
+	case "text":
+	case "github", "json", "csv":
+		reportFormat = *format
+		report.SetOutput(os.Stdout)
+		defer report.SetOutput(os.Stderr)
+	default:
+		return fmt.Errorf("unsupported -format value %q", *format)
+	}
+	var bundles []*bundle.Bundle
+	for _, name := range fs.Args() {
+		b, err := bundle.Open(name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer b.Close()
+		if len(bundles) > 0 && b.Meta() != bundles[0].Meta() {
+			return fmt.Errorf("%s has hashes computed with %q, but %s with %q",
+				name, b.Meta(), fs.Arg(0), bundles[0].Meta())
+		}
+		bundles = append(bundles, b)
+	}
+	idx := similar.NewIndex()
+	source := make(map[string]int) // names to positions of their bundles
+	groups := &groupTracker{ids: make(map[string]int)}
+	for i, b := range bundles {
+		for j := 0; j < b.Len(); j++ {
+			e := similar.Entry{Name: b.Name(j), Hash: b.Hash(j)}
+			if len(bundles) > 1 {
+				e.Name = fs.Arg(i) + ":" + e.Name
+			}
+			for _, m := range idx.Search(e.Hash, *threshold) {
+				if *across && source[m.Name] == i {
+					continue
+				}
+				reportPair(similar.Pair{Entry: e, Match: m}, groups)
+			}
+			idx.Add(e)
+			source[e.Name] = i
+		}
+	}
+	return nil
+}
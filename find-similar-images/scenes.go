@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar"
+)
+
+// reportScenes treats images in each directory under dir as consecutive
+// video frames, ordered by name, and reports runs of frames where each is
+// within threshold of the previous one as scene segments.
+func reportScenes(dir string, threshold int, opts []similar.Option) error {
+	frames := make(map[string][]string) // directory to its images
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && similar.IsImage(p) {
+			frames[filepath.Dir(p)] = append(frames[filepath.Dir(p)], p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	dirs := make([]string, 0, len(frames))
+	for d := range frames {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		names := frames[d]
+		sort.Slice(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+		results, err := similar.HashAll(context.Background(), names, opts...)
+		if err != nil {
+			return err
+		}
+		var scene, n int // n is the number of frames in current scene
+		var first, last similar.Result
+		flush := func() {
+			if n == 0 {
+				return
+			}
+			scene++
+			report.Printf("scene %d in %q: %s .. %s (%d frames)", scene, d,
+				filepath.Base(first.Path), filepath.Base(last.Path), n)
+		}
+		for _, r := range results {
+			if r.Err != nil {
+				log.Printf("%s: %v", r.Path, r.Err)
+				continue
+			}
+			if n > 0 && phash.Distance(r.Hash, last.Hash) > threshold {
+				flush()
+				n = 0
+			}
+			if n == 0 {
+				first = r
+			}
+			last = r
+			n++
+		}
+		flush()
+	}
+	return nil
+}
+
+// naturalLess compares strings so that runs of digits are ordered by their
+// numeric value: "frame_9" sorts before "frame_10".
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digits(a), digits(b)
+		if da > 0 && db > 0 {
+			na, nb := trimZeros(a[:da]), trimZeros(b[:db])
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[da:], b[db:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// digits returns length of leading run of ascii digits in s
+func digits(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+func trimZeros(s string) string {
+	for len(s) > 1 && s[0] == '0' {
+		s = s[1:]
+	}
+	return s
+}
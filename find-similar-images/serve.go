@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// maxUpload limits size of images posted to serve subcommand API
+const maxUpload = 64 << 20
+
+// serve implements "serve" subcommand: it indexes images in a directory once,
+// then serves HTTP API to hash images and look them up in the index.
+func serve(argv []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: find-similar-images serve [flags] dir\n\n"+
+			"POST /hash with an image as request body responds with its hash;\n"+
+			"POST /similar responds with indexed images close to posted one, nearest first.\n"+
+			"/similar accepts optional t (threshold) and limit query parameters.")
+		fs.PrintDefaults()
+	}
+	addr := fs.String("addr", "localhost:8080", "address to listen at")
+	threshold := fs.Int("t", similar.DefaultThreshold, "default phash distance threshold for /similar")
+	cacheName := fs.String("cache", "", "database file to cache computed hashes in, see -cache of the main command")
+	maxPixels := fs.Int("max-pixels", 100000000,
+		"skip indexed images and reject posted ones of more pixels than this, as decoding them takes too much memory; 0 for no limit")
+	fs.Parse(argv)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *threshold < 0 || *threshold > 64 {
+		return errors.New("-t must be in 0..64 range")
+	}
+	idx := similar.NewIndex()
+	opts := []similar.Option{similar.WithIndex(idx), similar.WithMaxPixels(*maxPixels)}
+	if *cacheName != "" {
+		cache, err := similar.OpenBoltCache(*cacheName, cacheBucket(similar.PHash, similar.LumaRec601, false, false, false))
+		if err != nil {
+			return err
+		}
+		defer cache.Close()
+		opts = append(opts, similar.WithCache(cache))
+	}
+	var skipped int // calls to error handler are serialized
+	opts = append(opts, similar.WithErrorHandler(func(name string, err error) {
+		skipped++
+		log.Printf("skipping %q: %v", name, err)
+	}))
+	begin := time.Now()
+	if err := similar.NewScanner(opts...).Scan(context.Background(), fs.Arg(0), func(similar.Pair) {}); err != nil {
+		return err
+	}
+	log.Printf("indexed %s in %v (%d files skipped), listening at %s", fs.Arg(0),
+		time.Since(begin).Round(time.Millisecond), skipped, *addr)
+	srv := &http.Server{
+		Addr:         *addr,
+		Handler:      &lookupHandler{idx: idx, threshold: *threshold, maxPixels: *maxPixels},
+		ReadTimeout:  time.Minute,
+		WriteTimeout: time.Minute,
+	}
+	return srv.ListenAndServe()
+}
+
+// lookupHandler serves serve subcommand API
+type lookupHandler struct {
+	threshold int
+	maxPixels int
+
+	mu  sync.Mutex // guards idx
+	idx similar.Index
+}
+
+func (h *lookupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/hash" && r.URL.Path != "/similar" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	threshold, limit := h.threshold, 0
+	for name, dst := range map[string]*int{"t": &threshold, "limit": &limit} {
+		if s := r.URL.Query().Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 || (name == "t" && n > 64) {
+				http.Error(w, "invalid "+name+" parameter", http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+	}
+	hash, err := similar.HashReader(http.MaxBytesReader(w, r.Body, maxUpload), similar.WithMaxPixels(h.maxPixels))
+	var large *similar.TooLargeError
+	var tooBig *http.MaxBytesError
+	switch {
+	case errors.As(err, &large) || errors.As(err, &tooBig):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, "cannot decode image: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/hash" {
+		json.NewEncoder(w).Encode(struct {
+			Hash string `json:"hash"`
+		}{Hash: fmt.Sprintf("%016x", hash)})
+		return
+	}
+	h.mu.Lock()
+	ms := h.idx.Search(hash, threshold)
+	h.mu.Unlock()
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].Distance < ms[j].Distance })
+	if limit > 0 && len(ms) > limit {
+		ms = ms[:limit]
+	}
+	type match struct {
+		Path     string `json:"path"`
+		Hash     string `json:"hash"`
+		Distance int    `json:"distance"`
+	}
+	out := struct {
+		Hash    string  `json:"hash"`
+		Matches []match `json:"matches"`
+	}{Hash: fmt.Sprintf("%016x", hash), Matches: []match{}}
+	for _, m := range ms {
+		out.Matches = append(out.Matches, match{Path: m.Name, Hash: fmt.Sprintf("%016x", m.Hash), Distance: m.Distance})
+	}
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// printStats logs a summary of resource usage of the run
+func printStats(st similar.Stats, elapsed time.Duration) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	log.Printf("stats: %d images in %v, %.1f images/sec", st.Files, elapsed.Round(time.Millisecond),
+		float64(st.Files)/elapsed.Seconds())
+	log.Printf("stats: walk %v, of which waited for queue %v; workers waited for files %v (summed over workers)",
+		st.WalkTime.Round(time.Millisecond), st.WalkStall.Round(time.Millisecond), st.WorkerStall.Round(time.Millisecond))
+	log.Printf("stats: %s (summed over workers)", formatStages(st.Stages))
+	for i, w := range st.Workers {
+		if w != (similar.Stages{}) && len(st.Workers) > 1 {
+			log.Printf("stats: worker %d: %d images, %s", i+1, w.Files, formatStages(w))
+		}
+	}
+	if rss := peakRSS(); rss > 0 {
+		log.Printf("stats: peak RSS %.1f MiB", float64(rss)/(1<<20))
+	}
+	log.Printf("stats: allocated %.1f MiB total, heap %.1f MiB, %d GC cycles, %v GC pauses",
+		float64(ms.TotalAlloc)/(1<<20), float64(ms.HeapSys)/(1<<20), ms.NumGC,
+		time.Duration(ms.PauseTotalNs).Round(time.Microsecond))
+}
+
+// formatStages returns time spent in each stage, with shares of the total
+func formatStages(st similar.Stages) string {
+	total := st.Open + st.Decode + st.Resize + st.Hash + st.Index
+	if total == 0 {
+		total = 1
+	}
+	var out []string
+	for _, v := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"open", st.Open},
+		{"decode", st.Decode},
+		{"resize", st.Resize},
+		{"hash", st.Hash},
+		{"index", st.Index},
+	} {
+		out = append(out, fmt.Sprintf("%s %v (%.0f%%)", v.name, v.d.Round(time.Millisecond), 100*float64(v.d)/float64(total)))
+	}
+	return strings.Join(out, ", ")
+}
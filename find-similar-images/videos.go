@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+// reportVideos hashes n evenly spaced frames of each video file under dir,
+// and reports pairs of videos which mean frame distance is within maxDist.
+// Videos that fail to decode are logged and skipped.
+func reportVideos(dir string, n int, maxDist float64, workers int, opts []similar.Option) error {
+	ctx := context.Background()
+	var names []string
+	// video interval only makes Walk list videos, frames are spaced by n
+	walkOpts := append(opts[:len(opts):len(opts)], similar.WithVideoFrames(time.Second))
+	err := similar.Walk(ctx, dir, func(p string, _ os.FileInfo) error {
+		if similar.IsVideo(p) {
+			names = append(names, p)
+		}
+		return nil
+	}, walkOpts...)
+	if err != nil {
+		return err
+	}
+	sigs := make([][]uint64, len(names))
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				sig, err := similar.HashVideoFrames(ctx, names[i], n, opts...)
+				if err != nil {
+					log.Print(err)
+					continue
+				}
+				sigs[i] = sig
+			}
+		}()
+	}
+	for i := range names {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+	for i, a := range sigs {
+		if a == nil {
+			continue
+		}
+		for j, b := range sigs[:i] {
+			if b == nil {
+				continue
+			}
+			if d := similar.FramesDistance(a, b); d <= maxDist {
+				reportFinding(names[i], "similar videos: %q is close (mean frame dist=%.1f over %d frames) to %q",
+					names[i], d, min(len(a), len(b)), names[j])
+			}
+		}
+	}
+	return nil
+}
@@ -1,9 +1,19 @@
 module github.com/artyom/phash-examples
 
-go 1.15
+go 1.22
 
 require (
 	github.com/artyom/phash v0.1.0
+	github.com/dhowden/tag v0.0.0-20240417053706-3d75831295e8
 	github.com/disintegration/imaging v1.6.2
-	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
+	github.com/nwaples/rardecode v1.1.3
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8
+	golang.org/x/sync v0.5.0
+	lukechampine.com/blake3 v1.4.1
+)
+
+require (
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
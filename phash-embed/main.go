@@ -0,0 +1,210 @@
+// Command phash-embed exports perceptual hashes of images found in a
+// directory as 64-dimensional binary vectors, in a format that TensorBoard
+// Embedding Projector (and most UMAP/t-SNE tooling) can load:
+//
+//	vectors.tsv            one row of 64 tab-separated 0/1 values per image
+//	metadata.tsv           file path and hex hash of each row
+//	sprite.png             thumbnails of all images, in row order
+//	projector_config.pbtxt config tying the files above together
+//
+// Load the output directory with "tensorboard --logdir DIR", or upload
+// vectors.tsv and metadata.tsv to projector.tensorflow.org.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/artyom/phash-examples/similar"
+	"github.com/disintegration/imaging"
+)
+
+func main() {
+	log.SetFlags(0)
+	args := runArgs{out: ".", thumb: 32}
+	flag.StringVar(&args.out, "out", args.out, "directory to write output files to")
+	flag.IntVar(&args.thumb, "thumb", args.thumb,
+		"sprite thumbnail size in pixels, reduced if sprite would exceed 8192×8192; 0 disables sprite")
+	flag.Parse()
+	args.dir = flag.Arg(0)
+	if err := run(args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type runArgs struct {
+	dir   string
+	out   string
+	thumb int
+}
+
+// maxSprite is the largest sprite dimension TensorBoard supports
+const maxSprite = 8192
+
+func run(args runArgs) error {
+	if args.dir == "" {
+		return errors.New("no directory given")
+	}
+	if args.thumb < 0 {
+		return errors.New("-thumb must not be negative")
+	}
+	var names []string
+	err := filepath.Walk(args.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && similar.IsImage(p) {
+			names = append(names, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if args.thumb > 0 && len(names) > 0 {
+		if side := int(math.Ceil(math.Sqrt(float64(len(names))))); side*args.thumb > maxSprite {
+			args.thumb = maxSprite / side
+			if args.thumb == 0 {
+				return fmt.Errorf("too many images (%d) for a sprite, use -thumb=0", len(names))
+			}
+			log.Printf("reduced thumbnail size to %d pixels to fit sprite", args.thumb)
+		}
+	}
+	points := hashAll(names, args.thumb)
+	ok := points[:0]
+	for _, p := range points {
+		if p.err != nil {
+			log.Printf("%q: %v", p.name, p.err)
+			continue
+		}
+		ok = append(ok, p)
+	}
+	if len(ok) == 0 {
+		return errors.New("no images found")
+	}
+	if err := writeTSV(filepath.Join(args.out, "vectors.tsv"), ok, false); err != nil {
+		return err
+	}
+	if err := writeTSV(filepath.Join(args.out, "metadata.tsv"), ok, true); err != nil {
+		return err
+	}
+	config := "embeddings {\n" +
+		"  tensor_path: \"vectors.tsv\"\n" +
+		"  metadata_path: \"metadata.tsv\"\n"
+	if args.thumb > 0 {
+		if err := writeSprite(filepath.Join(args.out, "sprite.png"), ok, args.thumb); err != nil {
+			return err
+		}
+		config += fmt.Sprintf("  sprite {\n"+
+			"    image_path: \"sprite.png\"\n"+
+			"    single_image_dim: %d\n"+
+			"    single_image_dim: %d\n"+
+			"  }\n", args.thumb, args.thumb)
+	}
+	config += "}\n"
+	return os.WriteFile(filepath.Join(args.out, "projector_config.pbtxt"), []byte(config), 0644)
+}
+
+type point struct {
+	name  string
+	hash  uint64
+	thumb image.Image // nil if sprite is disabled
+	err   error
+}
+
+// hashAll decodes and hashes named files concurrently, making thumbnails of
+// given size if it's not zero. Result is in the same order as names.
+func hashAll(names []string, thumb int) []point {
+	points := make([]point, len(names))
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				p := &points[i]
+				p.name = names[i]
+				img, err := imaging.Open(p.name, imaging.AutoOrientation(true))
+				if err != nil {
+					p.err = err
+					continue
+				}
+				if p.hash, p.err = similar.HashImage(img); p.err == nil && thumb > 0 {
+					p.thumb = imaging.Thumbnail(img, thumb, thumb, imaging.Lanczos)
+				}
+			}
+		}()
+	}
+	for i := range names {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+	return points
+}
+
+// writeTSV writes either unpacked hash bits of each point, or, if meta is
+// true, a metadata table with point names and hashes.
+func writeTSV(name string, points []point, meta bool) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if meta {
+		w.WriteString("path\thash\n")
+	}
+	for _, p := range points {
+		if meta {
+			// tabs and newlines would break the table
+			name := strings.NewReplacer("\t", " ", "\n", " ").Replace(p.name)
+			fmt.Fprintf(w, "%s\t%016x\n", name, p.hash)
+			continue
+		}
+		for i := 63; i >= 0; i-- {
+			w.WriteByte('0' + byte(p.hash>>uint(i)&1))
+			if i > 0 {
+				w.WriteByte('\t')
+			}
+		}
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeSprite writes a square grid of point thumbnails, filled row by row in
+// points order, as TensorBoard expects.
+func writeSprite(name string, points []point, thumb int) error {
+	side := int(math.Ceil(math.Sqrt(float64(len(points)))))
+	sprite := image.NewNRGBA(image.Rect(0, 0, side*thumb, side*thumb))
+	for i, p := range points {
+		at := image.Pt(i%side*thumb, i/side*thumb)
+		draw.Draw(sprite, image.Rectangle{at, at.Add(image.Pt(thumb, thumb))}, p.thumb, image.Point{}, draw.Src)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := png.Encode(f, sprite); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,96 @@
+// Command phash-layout prints perceptual hashes of images in all supported
+// bit layouts, which helps to figure out which layout some other tool or hash
+// database uses.
+//
+// With -selftest flag it instead verifies that hashes computed by this build
+// have the documented layout, see similar.BitOrder.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+
+	"github.com/artyom/phash-examples/similar"
+)
+
+func main() {
+	log.SetFlags(0)
+	var selfTest bool
+	flag.BoolVar(&selfTest, "selftest", selfTest, "verify bit layout of computed hashes and exit")
+	flag.Parse()
+	if selfTest {
+		if err := runSelfTest(); err != nil {
+			log.Fatal(err)
+		}
+		log.Print("self-test passed")
+		return
+	}
+	if err := run(flag.Args()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(names []string) error {
+	if len(names) == 0 {
+		return errors.New("no files given")
+	}
+	for _, name := range names {
+		hash, err := similar.HashFile(name)
+		if err != nil {
+			return err
+		}
+		for o := similar.ColumnMajorMSB; o <= similar.RowMajorLSB; o++ {
+			fmt.Printf("%016x\t%s\t%s\n", similar.ConvertBitOrder(hash, similar.ColumnMajorMSB, o), o, name)
+		}
+	}
+	return nil
+}
+
+// runSelfTest hashes synthetic images, each made of a single cosine wave
+// along one axis, and checks that the DC component and the wave frequency end
+// up in bits documented for similar.ColumnMajorMSB layout. It then checks that
+// conversion between every pair of layouts is reversible.
+func runSelfTest() error {
+	for _, tc := range []struct {
+		u, v int
+	}{{1, 0}, {0, 1}, {3, 0}, {0, 5}} {
+		hash, err := similar.HashImage(cosineImage(tc.u, tc.v))
+		if err != nil {
+			return err
+		}
+		want := uint64(1)<<63 | uint64(1)<<(63-(8*tc.u+tc.v))
+		if hash != want {
+			return fmt.Errorf("image with frequency (%d, %d): got hash %016x, want %016x",
+				tc.u, tc.v, hash, want)
+		}
+		for from := similar.ColumnMajorMSB; from <= similar.RowMajorLSB; from++ {
+			for to := similar.ColumnMajorMSB; to <= similar.RowMajorLSB; to++ {
+				if h := similar.ConvertBitOrder(similar.ConvertBitOrder(hash, from, to), to, from); h != hash {
+					return fmt.Errorf("%s → %s → %s conversion of %016x produced %016x",
+						from, to, from, hash, h)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cosineImage returns 32×32 grayscale image with a single DCT-II basis
+// function of horizontal frequency u and vertical frequency v.
+func cosineImage(u, v int) *image.Gray {
+	const size = 32
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			val := math.Cos(float64((2*x+1)*u)*math.Pi/(2*size)) *
+				math.Cos(float64((2*y+1)*v)*math.Pi/(2*size))
+			img.SetGray(x, y, color.Gray{Y: uint8(128 + 100*val)})
+		}
+	}
+	return img
+}
@@ -0,0 +1,131 @@
+package similar
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// Algorithm is a perceptual hash algorithm. All of them produce 64-bit hashes
+// compared by Hamming distance, but hashes of different algorithms are not
+// comparable with each other. Algorithms differ in what changes they
+// tolerate, and in their false positives: combining them improves
+// precision.
+type Algorithm int
+
+const (
+	// PHash is the DCT-based hash of github.com/artyom/phash package. This
+	// is the default.
+	PHash Algorithm = iota
+	// DHash is difference hash: bits tell whether brightness increases
+	// between horizontally adjacent pixels of a 9×8 image.
+	DHash
+	// AHash is average hash: bits tell whether pixels of an 8×8 image are
+	// brighter than their mean.
+	AHash
+	// WHash is wavelet hash: bits tell whether coefficients of the
+	// lowest-frequency 8×8 band of Haar wavelet decomposition are above
+	// their median.
+	WHash
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case PHash:
+		return "phash"
+	case DHash:
+		return "dhash"
+	case AHash:
+		return "ahash"
+	case WHash:
+		return "whash"
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+// ParseAlgorithm parses Algorithm from its string representation: "phash",
+// "dhash", "ahash" or "whash".
+func ParseAlgorithm(s string) (Algorithm, error) {
+	for a := PHash; a <= WHash; a++ {
+		if a.String() == s {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash algorithm %q", s)
+}
+
+// Set implements flag.Value interface.
+func (a *Algorithm) Set(s string) error {
+	v, err := ParseAlgorithm(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// WithAlgorithm sets hash algorithm. Default is PHash. Options changing
+// grayscale conversion, like WithLuma, WithNormalize and WithWatermarkMask,
+// apply to all algorithms.
+func WithAlgorithm(a Algorithm) Option { return func(c *config) { c.algo = a } }
+
+// hashOther hashes img with algorithm other than PHash
+func (cfg *config) hashOther(img image.Image) (uint64, error) {
+	gray := cfg.gray(img)
+	var hash uint64
+	switch cfg.algo {
+	case DHash:
+		small := imaging.Resize(gray, 9, 8, imaging.Lanczos)
+		for y := 0; y < 8; y++ {
+			row := small.Pix[y*small.Stride:]
+			for x := 0; x < 8; x++ {
+				hash <<= 1
+				// NRGBA pixels of a gray image, so any color channel will do
+				if row[4*x] < row[4*(x+1)] {
+					hash |= 1
+				}
+			}
+		}
+	case AHash:
+		small := imaging.Resize(gray, 8, 8, imaging.Lanczos)
+		var sum int
+		for i := 0; i < 64; i++ {
+			sum += int(small.Pix[4*i])
+		}
+		for i := 0; i < 64; i++ {
+			hash <<= 1
+			if int(small.Pix[4*i])*64 > sum {
+				hash |= 1
+			}
+		}
+	case WHash:
+		// LL band of a Haar transform is a scaled average of 2×2 blocks,
+		// repeated twice to get from 32×32 down to 8×8
+		var band [hashSize * hashSize]int
+		for i, v := range gray.Pix {
+			band[i] = int(v)
+		}
+		for side := hashSize / 2; side >= 8; side /= 2 {
+			for y := 0; y < side; y++ {
+				for x := 0; x < side; x++ {
+					src := 2*y*2*side + 2*x
+					band[y*side+x] = band[src] + band[src+1] + band[src+2*side] + band[src+2*side+1]
+				}
+			}
+		}
+		vals := append([]int(nil), band[:64]...)
+		sort.Ints(vals)
+		median := (vals[31] + vals[32]) / 2
+		for _, v := range band[:64] {
+			hash <<= 1
+			if v > median {
+				hash |= 1
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unsupported hash algorithm %v", cfg.algo)
+	}
+	return hash, nil
+}
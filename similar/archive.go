@@ -0,0 +1,108 @@
+package similar
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nwaples/rardecode"
+)
+
+// Page is an image stored inside an archive.
+type Page struct {
+	Name string // name of the image inside archive
+	Hash uint64
+}
+
+// IsArchive reports whether file name has an extension of an archive format
+// HashArchive supports: comic book archives (.cbz, .cbr) and EPUB books.
+func IsArchive(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".cbz", ".cbr", ".epub":
+		return true
+	}
+	return false
+}
+
+// HashArchive hashes all images (see IsImage) stored inside a .cbz, .cbr or
+// .epub file. Pages are returned sorted by their names.
+func HashArchive(name string, opts ...Option) ([]Page, error) {
+	cfg := newConfig(opts)
+	var pages []Page
+	var err error
+	if strings.EqualFold(filepath.Ext(name), ".cbr") {
+		pages, err = cfg.hashRar(name)
+	} else {
+		pages, err = cfg.hashZip(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Name < pages[j].Name })
+	return pages, nil
+}
+
+func (cfg *config) hashZip(name string) ([]Page, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var pages []Page
+	for _, f := range zr.File {
+		if !isPage(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := cfg.hashReader(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		pages = append(pages, Page{Name: f.Name, Hash: hash})
+	}
+	return pages, nil
+}
+
+func (cfg *config) hashRar(name string) ([]Page, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rr, err := rardecode.NewReader(f, "")
+	if err != nil {
+		return nil, err
+	}
+	var pages []Page
+	for {
+		hdr, err := rr.Next()
+		if err == io.EOF {
+			return pages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.IsDir || !isPage(hdr.Name) {
+			continue
+		}
+		hash, err := cfg.hashReader(rr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		pages = append(pages, Page{Name: hdr.Name, Hash: hash})
+	}
+}
+
+// isPage reports whether archive member name looks like an image
+func isPage(name string) bool {
+	return isImageExt(path.Ext(name))
+}
@@ -0,0 +1,98 @@
+package similar
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithAutoWorkers makes Scanner adjust the number of images processed
+// concurrently while scanning, between 1 and max, looking for the number
+// giving the best throughput. This helps when the best setting is not known
+// in advance: CPU-bound scans of local disk do best with about
+// DefaultWorkers() workers, while scans of slow network mounts benefit
+// from more parallel reads. It overrides WithWorkers.
+func WithAutoWorkers(max int) Option {
+	return func(c *config) {
+		if max > 0 {
+			c.autoWorkers = max
+		}
+	}
+}
+
+// limiter allows at most limit holders at a time, limit can be changed at
+// any time.
+type limiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	active int
+	limit  int
+}
+
+func newLimiter(n int) *limiter {
+	l := &limiter{limit: n}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *limiter) acquire() {
+	l.mu.Lock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+	l.mu.Unlock()
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	l.cond.Signal()
+}
+
+func (l *limiter) set(n int) {
+	l.mu.Lock()
+	l.limit = n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// autoscale adjusts l limit every interval until ctx is canceled, doing hill
+// climbing on the rate at which files counter grows: the limit keeps moving
+// in one direction while throughput improves, and reverses direction once
+// throughput drops.
+func autoscale(ctx context.Context, l *limiter, files *int64, start, max int) {
+	const interval = time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	limit, dir := start, 1
+	var prevFiles, prevRate int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n := atomic.LoadInt64(files)
+		rate := n - prevFiles
+		prevFiles = n
+		if rate < prevRate-prevRate/20 {
+			dir = -dir
+		}
+		prevRate = rate
+		step := limit / 4
+		if step < 1 {
+			step = 1
+		}
+		limit += dir * step
+		if limit < 1 {
+			limit, dir = 1, 1
+		}
+		if limit > max {
+			limit, dir = max, -1
+		}
+		l.set(limit)
+	}
+}
@@ -0,0 +1,86 @@
+package similar
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// BitOrder describes how the 8×8 low frequency DCT coefficients are laid out
+// in 64 hash bits. Coefficient (u, v) is the one with horizontal frequency u
+// and vertical frequency v, (0, 0) being the DC component.
+//
+// Tools computing the same kind of hash often disagree on bit layout, and
+// comparing hashes of different layouts does not fail, it just produces
+// meaningless distances. Use ConvertBitOrder to bring hashes to a common
+// layout before comparing them.
+type BitOrder int
+
+const (
+	// ColumnMajorMSB is the layout of hashes produced by this package and
+	// github.com/artyom/phash: coefficient (u, v) is stored in bit
+	// 63-(8*u+v), so the most significant bit holds the DC component, and
+	// the first byte holds all vertical frequencies of u=0.
+	ColumnMajorMSB BitOrder = iota
+	// RowMajorMSB stores coefficient (u, v) in bit 63-(8*v+u). This is the
+	// layout produced by flattening an [y][x] indexed coefficient matrix row
+	// by row, with the first coefficient in the most significant bit, as
+	// done by Python imagehash library.
+	RowMajorMSB
+	// ColumnMajorLSB stores coefficient (u, v) in bit 8*u+v.
+	ColumnMajorLSB
+	// RowMajorLSB stores coefficient (u, v) in bit 8*v+u.
+	RowMajorLSB
+)
+
+func (o BitOrder) String() string {
+	switch o {
+	case ColumnMajorMSB:
+		return "column-major-msb"
+	case RowMajorMSB:
+		return "row-major-msb"
+	case ColumnMajorLSB:
+		return "column-major-lsb"
+	case RowMajorLSB:
+		return "row-major-lsb"
+	}
+	return fmt.Sprintf("BitOrder(%d)", int(o))
+}
+
+// ParseBitOrder parses BitOrder from its string representation.
+func ParseBitOrder(s string) (BitOrder, error) {
+	for o := ColumnMajorMSB; o <= RowMajorLSB; o++ {
+		if o.String() == s {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown bit order %q", s)
+}
+
+// ConvertBitOrder converts hash from one bit layout to another.
+func ConvertBitOrder(hash uint64, from, to BitOrder) uint64 {
+	if from == to {
+		return hash
+	}
+	if from == ColumnMajorLSB || from == RowMajorLSB {
+		hash = bits.Reverse64(hash)
+	}
+	if (from == RowMajorMSB || from == RowMajorLSB) != (to == RowMajorMSB || to == RowMajorLSB) {
+		hash = transpose8x8(hash)
+	}
+	if to == ColumnMajorLSB || to == RowMajorLSB {
+		hash = bits.Reverse64(hash)
+	}
+	return hash
+}
+
+// transpose8x8 transposes a 8×8 bit matrix stored byte per row.
+func transpose8x8(x uint64) uint64 {
+	// Hacker's Delight, 7-3: swap bits across 2×2, 4×4 and 8×8 blocks
+	t := (x ^ (x >> 7)) & 0x00AA00AA00AA00AA
+	x = x ^ t ^ (t << 7)
+	t = (x ^ (x >> 14)) & 0x0000CCCC0000CCCC
+	x = x ^ t ^ (t << 14)
+	t = (x ^ (x >> 28)) & 0x00000000F0F0F0F0
+	x = x ^ t ^ (t << 28)
+	return x
+}
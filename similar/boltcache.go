@@ -0,0 +1,96 @@
+package similar
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltCache is a Cache keeping hashes in a bbolt database file, keyed by file
+// name and validated by file size and modification time.
+//
+// Hash values depend on options like WithLuma, WithNormalize and
+// WithWatermarkMask, so entries are kept in a named bucket: hashes computed
+// with different options can share one file if they use different buckets.
+type BoltCache struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// OpenBoltCache opens or creates database file and returns cache using given
+// bucket in it. Database is not synced to disk on every update, losing
+// recent updates on crash only means files are hashed again; Close syncs
+// it.
+func OpenBoltCache(name, bucket string) (*BoltCache, error) {
+	if bucket == "" {
+		return nil, errors.New("empty bucket name")
+	}
+	db, err := bolt.Open(name, 0666, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	db.NoSync = true
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltCache{db: db, bucket: []byte(bucket)}, nil
+}
+
+// Get implements Cache interface.
+func (c *BoltCache) Get(name string, size int64, mtime time.Time) (hash uint64, ok bool) {
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		// size, mtime in unix nanoseconds, hash
+		v := tx.Bucket(c.bucket).Get([]byte(name))
+		if len(v) != 24 ||
+			int64(binary.BigEndian.Uint64(v)) != size ||
+			int64(binary.BigEndian.Uint64(v[8:])) != mtime.UnixNano() {
+			return nil
+		}
+		hash, ok = binary.BigEndian.Uint64(v[16:]), true
+		return nil
+	})
+	return hash, ok
+}
+
+// Put implements Cache interface. Concurrent calls are combined into a single
+// database transaction.
+func (c *BoltCache) Put(name string, size int64, mtime time.Time, hash uint64) error {
+	v := make([]byte, 24)
+	binary.BigEndian.PutUint64(v, uint64(size))
+	binary.BigEndian.PutUint64(v[8:], uint64(mtime.UnixNano()))
+	binary.BigEndian.PutUint64(v[16:], hash)
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bucket).Put([]byte(name), v)
+	})
+}
+
+// Walk calls fn for each file in cache in order of their names, stopping on
+// the first error fn returns.
+func (c *BoltCache) Walk(fn func(name string, size int64, mtime time.Time, hash uint64) error) error {
+	return c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bucket).ForEach(func(k, v []byte) error {
+			if len(v) != 24 {
+				return nil
+			}
+			size := int64(binary.BigEndian.Uint64(v))
+			mtime := time.Unix(0, int64(binary.BigEndian.Uint64(v[8:])))
+			return fn(string(k), size, mtime, binary.BigEndian.Uint64(v[16:]))
+		})
+	})
+}
+
+// Close syncs database to disk and closes it.
+func (c *BoltCache) Close() error {
+	if err := c.db.Sync(); err != nil {
+		c.db.Close()
+		return err
+	}
+	return c.db.Close()
+}
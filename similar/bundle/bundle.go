@@ -0,0 +1,160 @@
+// Package bundle reads and writes read-only image hash indexes packed into
+// a single file, to ship a prebuilt index of a collection with an
+// application, either as a separate file or embedded into its binary.
+//
+// Bundle layout is usable in place, so it can be memory mapped or embedded
+// without being parsed into separate structures. All integers are little
+// endian:
+//
+//	magic       8 bytes, "PHBUNDL1"
+//	count       uint64, number of entries
+//	meta size   uint64
+//	meta        free-form text, padded with zeros to a multiple of 8 bytes
+//	hashes      count uint64 hashes
+//	name ends   count uint64 offsets where each name ends in names
+//	names       concatenated names
+package bundle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+const magic = "PHBUNDL1"
+
+// Bundle is a read-only index of named hashes.
+type Bundle struct {
+	data   []byte
+	count  int
+	meta   string
+	hashes []byte // count*8 bytes
+	ends   []byte // count*8 bytes
+	names  []byte
+	unmap  func()
+}
+
+// Match is an entry found by Bundle.Search.
+type Match struct {
+	Index    int // position of the entry in bundle
+	Name     string
+	Hash     uint64
+	Distance int
+}
+
+// Write writes a bundle of names and their hashes, which must be of the
+// same length, to w. Meta is stored as is, and is usually used to describe
+// how hashes were computed.
+func Write(w io.Writer, meta string, names []string, hashes []uint64) error {
+	if len(names) != len(hashes) {
+		return errors.New("bundle: names and hashes differ in length")
+	}
+	bw := bufio.NewWriter(w)
+	var buf [8]byte
+	putUint := func(v uint64) {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		bw.Write(buf[:])
+	}
+	bw.WriteString(magic)
+	putUint(uint64(len(names)))
+	putUint(uint64(len(meta)))
+	bw.WriteString(meta)
+	bw.Write(make([]byte, pad(len(meta))))
+	for _, h := range hashes {
+		putUint(h)
+	}
+	var end uint64
+	for _, name := range names {
+		end += uint64(len(name))
+		putUint(end)
+	}
+	for _, name := range names {
+		bw.WriteString(name)
+	}
+	return bw.Flush()
+}
+
+// pad returns number of bytes needed to pad n bytes to a multiple of 8
+func pad(n int) int { return (8 - n%8) % 8 }
+
+// ErrFormat is returned by Load and Open for data which is not a valid bundle.
+var ErrFormat = errors.New("bundle: invalid format")
+
+// Load returns bundle stored in data, which is used in place and must not be
+// modified while Bundle is in use. It is suitable for bundles embedded with
+// go:embed directive.
+func Load(data []byte) (*Bundle, error) {
+	if len(data) < 24 || string(data[:8]) != magic {
+		return nil, ErrFormat
+	}
+	count := binary.LittleEndian.Uint64(data[8:])
+	metaSize := binary.LittleEndian.Uint64(data[16:])
+	rest := uint64(len(data) - 24)
+	if metaSize > rest || count > (rest-metaSize)/16 {
+		return nil, ErrFormat
+	}
+	b := &Bundle{data: data, count: int(count)}
+	off := 24 + int(metaSize)
+	b.meta = string(data[24:off])
+	off += pad(int(metaSize))
+	if len(data) < off+16*b.count {
+		return nil, ErrFormat
+	}
+	b.hashes = data[off : off+8*b.count]
+	b.ends = data[off+8*b.count : off+16*b.count]
+	b.names = data[off+16*b.count:]
+	if b.count > 0 && b.end(b.count-1) != uint64(len(b.names)) {
+		return nil, ErrFormat
+	}
+	return b, nil
+}
+
+// Close releases memory mapping of bundle returned by Open. It is a no-op
+// for bundles returned by Load. Bundle must not be used after Close.
+func (b *Bundle) Close() error {
+	if b.unmap != nil {
+		b.unmap()
+		b.unmap = nil
+	}
+	return nil
+}
+
+// Meta returns free-form text stored along with hashes.
+func (b *Bundle) Meta() string { return b.meta }
+
+// Len returns the number of entries.
+func (b *Bundle) Len() int { return b.count }
+
+// Hash returns hash of i-th entry.
+func (b *Bundle) Hash(i int) uint64 { return binary.LittleEndian.Uint64(b.hashes[8*i:]) }
+
+// Name returns name of i-th entry.
+func (b *Bundle) Name(i int) string {
+	var start uint64
+	if i > 0 {
+		start = b.end(i - 1)
+	}
+	end := b.end(i)
+	if start > end || end > uint64(len(b.names)) {
+		return "" // corrupt bundle
+	}
+	return string(b.names[start:end])
+}
+
+func (b *Bundle) end(i int) uint64 { return binary.LittleEndian.Uint64(b.ends[8*i:]) }
+
+// Search returns entries which hashes are within maxDist of hash, in order
+// of their positions in bundle. It checks every entry, which takes a few
+// milliseconds per million entries.
+func (b *Bundle) Search(hash uint64, maxDist int) []Match {
+	var out []Match
+	for i := 0; i < b.count; i++ {
+		h := b.Hash(i)
+		if d := bits.OnesCount64(h ^ hash); d <= maxDist {
+			out = append(out, Match{Index: i, Name: b.Name(i), Hash: h, Distance: d})
+		}
+	}
+	return out
+}
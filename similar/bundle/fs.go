@@ -0,0 +1,20 @@
+package bundle
+
+import "io/fs"
+
+// LoadFS returns bundle stored in named file of fsys, like an embed.FS:
+//
+//	//go:embed catalog.bundle
+//	var files embed.FS
+//
+//	b, err := bundle.LoadFS(files, "catalog.bundle")
+//
+// File is read into memory whole. To use an embedded bundle in place
+// instead, embed it into a []byte variable and pass it to Load.
+func LoadFS(fsys fs.FS, name string) (*Bundle, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return Load(data)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package bundle
+
+import (
+	"errors"
+	"os"
+)
+
+func mmap(*os.File, int) ([]byte, error) { return nil, errors.New("mmap is not supported") }
+
+func munmap([]byte) {}
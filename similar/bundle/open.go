@@ -0,0 +1,37 @@
+package bundle
+
+import (
+	"io"
+	"os"
+)
+
+// Open returns bundle stored in named file. Where supported, file is memory
+// mapped rather than read, so opening even a large bundle is cheap, and its
+// pages are shared between processes. Bundle must be closed after use.
+func Open(name string) (*Bundle, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if size := fi.Size(); size > 0 && int64(int(size)) == size {
+		if data, err := mmap(f, int(size)); err == nil {
+			b, err := Load(data)
+			if err != nil {
+				munmap(data)
+				return nil, err
+			}
+			b.unmap = func() { munmap(data) }
+			return b, nil
+		}
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return Load(data)
+}
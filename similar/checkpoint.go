@@ -0,0 +1,135 @@
+package similar
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checkpoint is a Cache keeping hashes of files scanned so far in a text
+// file, one file per line, so that an interrupted scan can be resumed
+// without hashing them again. Records are buffered, and only written to file
+// on Flush and Close.
+type Checkpoint struct {
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	hashes map[string]stampedHash
+}
+
+type stampedHash struct {
+	fileStamp
+	hash uint64
+}
+
+// OpenCheckpoint creates file used to store hashes. With resume, it instead
+// opens file if it exists, and loads hashes already stored there. Tag
+// describes hashing settings: it is stored in the file, and resuming from a
+// file having different tag fails, as stored hashes are not comparable with
+// new ones.
+func OpenCheckpoint(name, tag string, resume bool) (*Checkpoint, error) {
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_RDWR | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(name, flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{f: f, w: bufio.NewWriter(f), hashes: make(map[string]stampedHash)}
+	sc := bufio.NewScanner(f)
+	line := 0
+	for ; sc.Scan(); line++ {
+		if line == 0 {
+			if sc.Text() != "# "+tag {
+				f.Close()
+				return nil, fmt.Errorf("%s was written with different hash settings (%s)",
+					name, strings.TrimPrefix(sc.Text(), "# "))
+			}
+			continue
+		}
+		// hash<TAB>size<TAB>mtime<TAB>name
+		fields := strings.SplitN(sc.Text(), "\t", 4)
+		if len(fields) != 4 {
+			continue // likely truncated by interruption
+		}
+		hash, err1 := strconv.ParseUint(fields[0], 16, 64)
+		size, err2 := strconv.ParseInt(fields[1], 10, 64)
+		mtime, err3 := strconv.ParseInt(fields[2], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		c.hashes[fields[3]] = stampedHash{fileStamp: fileStamp{size: size, mtime: mtime}, hash: hash}
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	if line == 0 {
+		if _, err := fmt.Fprintf(c.w, "# %s\n", tag); err != nil {
+			f.Close()
+			return nil, err
+		}
+	} else if fi, err := f.Stat(); err == nil {
+		// terminate last record if interruption left it incomplete
+		b := make([]byte, 1)
+		if _, err := f.ReadAt(b, fi.Size()-1); err == nil && b[0] != '\n' {
+			c.w.WriteByte('\n')
+		}
+	}
+	return c, nil
+}
+
+// Len returns the number of hashes stored.
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.hashes)
+}
+
+// Get implements Cache interface.
+func (c *Checkpoint) Get(name string, size int64, mtime time.Time) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.hashes[name]
+	if !ok || h.fileStamp != (fileStamp{size: size, mtime: mtime.UnixNano()}) {
+		return 0, false
+	}
+	return h.hash, true
+}
+
+// Put implements Cache interface.
+func (c *Checkpoint) Put(name string, size int64, mtime time.Time, hash uint64) error {
+	if strings.ContainsAny(name, "\t\n") {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := fileStamp{size: size, mtime: mtime.UnixNano()}
+	c.hashes[name] = stampedHash{fileStamp: st, hash: hash}
+	_, err := fmt.Fprintf(c.w, "%016x\t%d\t%d\t%s\n", hash, st.size, st.mtime, name)
+	return err
+}
+
+// Flush writes buffered records to file and syncs it to disk.
+func (c *Checkpoint) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	return c.f.Sync()
+}
+
+// Close flushes buffered records and closes underlying file.
+func (c *Checkpoint) Close() error {
+	if err := c.Flush(); err != nil {
+		c.f.Close()
+		return err
+	}
+	return c.f.Close()
+}
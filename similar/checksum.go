@@ -0,0 +1,141 @@
+package similar
+
+import (
+	"bytes"
+	"hash"
+	"io"
+	"os"
+)
+
+// WithChecksum makes Scanner compute a checksum of each image file content
+// using hash function returned by newHash, for example sha256.New. Checksum
+// is reported in Entry.Checksum, and allows to verify byte identity of files
+// before acting on them. Checksum is computed while file is read for
+// decoding, so files are not read twice, unless their hashes are taken
+// from a Cache.
+//
+// Files of at least 1 MiB are fed to the hash in large writes, which lets
+// implementations like lukechampine.com/blake3 hash them on multiple cores.
+func WithChecksum(newHash func() hash.Hash) Option {
+	return func(c *config) { c.checksum = newHash }
+}
+
+// Files of bigFile size or larger are passed to checksum hash in writes of
+// up to bigWrite bytes.
+const (
+	bigFile  = 1 << 20
+	bigWrite = 8 << 20
+)
+
+// hashFileChecksum is like hashFile, but also returns checksum of file
+// content if checksum is configured.
+func (cfg *config) hashFileChecksum(name string) (uint64, []byte, error) {
+	if cfg.checksum == nil {
+		hash, err := cfg.hashFile(name)
+		return hash, nil, err
+	}
+	f, err := cfg.open(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+	h := cfg.checksum()
+	if cfg.mmap {
+		if data, unmap, ok := mapFile(f); ok {
+			defer unmap()
+			var hash uint64
+			err := withFaults(func() (err error) {
+				h.Write(data)
+				hash, err = cfg.hashReader(bytes.NewReader(data))
+				return err
+			})
+			if err != nil {
+				return 0, nil, err
+			}
+			return hash, h.Sum(nil), nil
+		}
+	}
+	if st.Size() >= bigFile {
+		t := &chunkTee{r: f, w: h, buf: make([]byte, bigWrite)}
+		hash, err := cfg.hashReader(t)
+		if err != nil {
+			return 0, nil, err
+		}
+		if t.err == nil {
+			// hide f's WriteTo, so that CopyBuffer uses buf
+			if _, err := io.CopyBuffer(h, struct{ io.Reader }{f}, t.buf); err != nil {
+				return 0, nil, err
+			}
+		} else if t.err != io.EOF {
+			return 0, nil, t.err
+		}
+		return hash, h.Sum(nil), nil
+	}
+	hash, err := cfg.hashReader(io.TeeReader(f, h))
+	if err != nil {
+		return 0, nil, err
+	}
+	// decoder may stop reading before the end of file
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, nil, err
+	}
+	return hash, h.Sum(nil), nil
+}
+
+// chunkTee is like io.TeeReader, but reads from r in chunks of len(buf),
+// writing each to w as a whole, however small reads from chunkTee are.
+type chunkTee struct {
+	r    io.Reader
+	w    io.Writer
+	buf  []byte
+	data []byte // not yet read part of buf
+	err  error  // of the last read from r
+}
+
+func (t *chunkTee) Read(p []byte) (int, error) {
+	if len(t.data) == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		n, err := io.ReadFull(t.r, t.buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		t.w.Write(t.buf[:n])
+		t.data, t.err = t.buf[:n], err
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, t.data)
+	t.data = t.data[n:]
+	return n, nil
+}
+
+// checksumFile returns checksum of file content.
+func (cfg *config) checksumFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h := cfg.checksum()
+	if st.Size() < bigFile {
+		_, err = io.Copy(h, f)
+	} else {
+		// hide f's WriteTo, so that CopyBuffer uses buf
+		_, err = io.CopyBuffer(h, struct{ io.Reader }{f}, make([]byte, bigWrite))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,55 @@
+package similar
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// ErrNoCoverArt is returned by ReadTrack for audio files without embedded
+// cover art.
+var ErrNoCoverArt = errors.New("no embedded cover art")
+
+// Track describes an audio file with embedded cover art.
+type Track struct {
+	Album  string
+	Artist string // album artist, or track artist if album artist is not set
+	Hash   uint64 // hash of cover art image
+}
+
+// ReadTrack reads metadata of mp3, flac or m4a file from r and hashes cover
+// art image embedded into it. It returns ErrNoCoverArt if file has no cover
+// art.
+func ReadTrack(r io.ReadSeeker, opts ...Option) (*Track, error) {
+	m, err := tag.ReadFrom(r)
+	if err != nil {
+		return nil, err
+	}
+	pic := m.Picture()
+	if pic == nil || len(pic.Data) == 0 {
+		return nil, ErrNoCoverArt
+	}
+	hash, err := newConfig(opts).hashReader(bytes.NewReader(pic.Data))
+	if err != nil {
+		return nil, err
+	}
+	t := &Track{Album: m.Album(), Artist: m.AlbumArtist(), Hash: hash}
+	if t.Artist == "" {
+		t.Artist = m.Artist()
+	}
+	return t, nil
+}
+
+// IsAudio reports whether file name has an extension of an audio format
+// ReadTrack supports.
+func IsAudio(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp3", ".flac", ".m4a":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package similar
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// WithCrop makes functions hash only rectangle r of each image, for example
+// to match an area where logo is placed across many images. Coordinates are
+// relative to the top left corner of the image, after EXIF orientation is
+// applied. Rectangle is clipped to image bounds; images it doesn't overlap
+// fail to hash with an error.
+//
+// Cropping changes hash values, so hashes stored in a Cache without cropping
+// should not be used with this option.
+func WithCrop(r image.Rectangle) Option {
+	return func(c *config) {
+		r := r.Canon()
+		c.crop = &r
+	}
+}
+
+// cropImage returns part of img selected by WithCrop.
+func (cfg *config) cropImage(img image.Image) (image.Image, error) {
+	b := img.Bounds()
+	r := cfg.crop.Add(b.Min).Intersect(b)
+	if r.Empty() {
+		return nil, fmt.Errorf("crop rectangle %v is outside of %dx%d image", *cfg.crop, b.Dx(), b.Dy())
+	}
+	return imaging.Crop(img, r), nil
+}
@@ -0,0 +1,129 @@
+package similar
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of a file listing glob patterns, one per line, of
+// files and directories Scanner skips in the directory containing it and
+// below. Patterns are matched as WithExclude ones, but relative to that
+// directory. Empty lines and lines starting with # are ignored.
+const IgnoreFile = ".phashignore"
+
+// WithExclude makes Scanner skip files and directories matching any of glob
+// patterns, as understood by filepath.Match. Patterns without a slash are
+// matched against base names, others against slash separated paths relative
+// to the scanned directory. Patterns with a trailing slash only match
+// directories. Excluded directories are not descended into.
+func WithExclude(patterns ...string) Option {
+	return func(c *config) { c.exclude = append(c.exclude, patterns...) }
+}
+
+// WithMaxDepth limits how many directory levels below the scanned directory
+// Scanner descends: 0 only scans files of the directory itself. Negative
+// values mean no limit, which is the default.
+func WithMaxDepth(n int) Option { return func(c *config) { c.maxDepth = n } }
+
+// excluder decides which paths directory walk skips
+type excluder struct {
+	root     string
+	patterns []string
+	maxDepth int
+	ignored  map[string][]string // patterns of IgnoreFile files, by directory
+}
+
+func newExcluder(root string, cfg *config) *excluder {
+	if cfg.spotlight {
+		// spotlightWalk reports absolute paths
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+	}
+	return &excluder{
+		root:     filepath.Clean(root),
+		patterns: cfg.exclude,
+		maxDepth: cfg.maxDepth,
+		ignored:  make(map[string][]string),
+	}
+}
+
+// skip reports whether walk should skip path p. It must be called for
+// directories before their content, as it loads their IgnoreFile files.
+func (x *excluder) skip(p string, info os.FileInfo) bool {
+	p = filepath.Clean(p)
+	if p != x.root {
+		rel, err := filepath.Rel(x.root, p)
+		if err != nil {
+			return false
+		}
+		if depth := strings.Count(rel, string(filepath.Separator)); x.maxDepth >= 0 &&
+			(depth > x.maxDepth || info.IsDir() && depth == x.maxDepth) {
+			return true
+		}
+		if matchAny(x.patterns, rel, info.IsDir()) {
+			return true
+		}
+		for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+			if patterns := x.ignored[dir]; patterns != nil {
+				if rel, err := filepath.Rel(dir, p); err == nil && matchAny(patterns, rel, info.IsDir()) {
+					return true
+				}
+			}
+			if dir == x.root || dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+	if info.IsDir() {
+		if patterns := readIgnoreFile(filepath.Join(p, IgnoreFile)); patterns != nil {
+			x.ignored[p] = patterns
+		}
+	}
+	return false
+}
+
+// matchAny reports whether relative path rel matches any of patterns, see
+// WithExclude
+func matchAny(patterns []string, rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	base := rel[strings.LastIndexByte(rel, '/')+1:]
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		name := base
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readIgnoreFile returns patterns listed in named file, or nil if it can't
+// be read
+func readIgnoreFile(name string) []string {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var out []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
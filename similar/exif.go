@@ -0,0 +1,161 @@
+package similar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exif is metadata stored in EXIF segment of a jpeg image.
+type Exif struct {
+	Taken       time.Time // when photo was taken, in local time zone as EXIF has none
+	Camera      string    // camera make and model
+	Orientation int       // 1 to 8, 0 if unset
+	GPS         bool      // image has location data
+}
+
+// ReadExif reads EXIF metadata of named jpeg image. It returns zero Exif for
+// images without EXIF segment, and for other formats.
+func ReadExif(name string) (Exif, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return Exif{}, err
+	}
+	defer f.Close()
+	head := make([]byte, exifHead)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return Exif{}, err
+	}
+	return parseExif(head[:n]), nil
+}
+
+// EXIF tags parseExif looks for
+const (
+	tagMake         = 0x010f
+	tagModel        = 0x0110
+	tagOrientation  = 0x0112
+	tagDateTime     = 0x0132
+	tagExifIFD      = 0x8769
+	tagGPSIFD       = 0x8825
+	tagDateOriginal = 0x9003
+)
+
+// parseExif returns metadata from EXIF segment of jpeg image which beginning
+// is in b
+func parseExif(b []byte) Exif {
+	var x Exif
+	tiff := exifSegment(b)
+	if len(tiff) < 8 {
+		return x
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return x
+	}
+	var maker, model, taken, original string
+	var exifIFD uint32
+	walkIFD(tiff, order, order.Uint32(tiff[4:]), func(tag uint16, e []byte) {
+		switch tag {
+		case tagMake:
+			maker = exifString(tiff, order, e)
+		case tagModel:
+			model = exifString(tiff, order, e)
+		case tagOrientation:
+			x.Orientation = int(order.Uint16(e[8:]))
+		case tagDateTime:
+			taken = exifString(tiff, order, e)
+		case tagExifIFD:
+			exifIFD = order.Uint32(e[8:])
+		case tagGPSIFD:
+			x.GPS = order.Uint32(e[8:]) != 0
+		}
+	})
+	if exifIFD != 0 {
+		walkIFD(tiff, order, exifIFD, func(tag uint16, e []byte) {
+			if tag == tagDateOriginal {
+				original = exifString(tiff, order, e)
+			}
+		})
+	}
+	if original != "" {
+		taken = original
+	}
+	if t, err := time.ParseInLocation("2006:01:02 15:04:05", taken, time.Local); err == nil {
+		x.Taken = t
+	}
+	switch {
+	case strings.HasPrefix(model, maker):
+		x.Camera = model
+	case maker != "" && model != "":
+		x.Camera = maker + " " + model
+	default:
+		x.Camera = maker + model
+	}
+	return x
+}
+
+// exifSegment returns TIFF structure of EXIF APP1 segment of jpeg image which
+// beginning is in b, or nil if there's none
+func exifSegment(b []byte) []byte {
+	if len(b) < 2 || b[0] != 0xff || b[1] != 0xd8 {
+		return nil
+	}
+	b = b[2:]
+	for len(b) >= 4 && b[0] == 0xff {
+		marker, size := b[1], int(binary.BigEndian.Uint16(b[2:]))
+		if size < 2 || len(b) < 2+size {
+			return nil
+		}
+		seg := b[4 : 2+size]
+		b = b[2+size:]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+	}
+	return nil
+}
+
+// walkIFD calls fn for each 12 byte entry of IFD at off: tag, type, count and
+// value or its offset
+func walkIFD(tiff []byte, order binary.ByteOrder, off uint32, fn func(tag uint16, entry []byte)) {
+	if off < 8 || int64(off)+2 > int64(len(tiff)) {
+		return
+	}
+	ifd := tiff[off:]
+	for i := 0; i < int(order.Uint16(ifd)); i++ {
+		if 2+12*(i+1) > len(ifd) {
+			return
+		}
+		e := ifd[2+12*i:]
+		fn(order.Uint16(e), e[:12])
+	}
+}
+
+// exifString returns value of ASCII IFD entry
+func exifString(tiff []byte, order binary.ByteOrder, e []byte) string {
+	const typeASCII = 2
+	if order.Uint16(e[2:]) != typeASCII {
+		return ""
+	}
+	n := int64(order.Uint32(e[4:]))
+	val := e[8:12]
+	if n > 4 {
+		off := int64(order.Uint32(e[8:]))
+		if off+n > int64(len(tiff)) {
+			return ""
+		}
+		val = tiff[off : off+n]
+	} else {
+		val = val[:n]
+	}
+	return strings.TrimSpace(strings.TrimRight(string(val), "\x00"))
+}
@@ -0,0 +1,132 @@
+package similar
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DecodeError is returned when image could not be decoded.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string { return e.Err.Error() }
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// WithErrorHandler makes Scanner pass errors reading or decoding individual
+// files (and listing directories below the scanned one) to fn, and continue
+// Scan, instead of stopping on them. Errors not specific to a file, like
+// those of Cache or FailureCache, still stop Scan. Calls to fn are
+// serialized.
+func WithErrorHandler(fn func(name string, err error)) Option {
+	return func(c *config) { c.onError = fn }
+}
+
+// fileError handles error processing named file: unless WithErrorHandler is
+// set, or err is a context one, it is returned as is. Too large images are
+// skipped either way.
+func (s *Scanner) fileError(name string, err error) error {
+	atomic.AddInt64(&s.cfg.stats.errors, 1)
+	var large *TooLargeError
+	if s.cfg.onError == nil && errors.As(err, &large) {
+		return nil // skipped, see WithMaxPixels
+	}
+	if s.cfg.onError == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg.onError(name, err)
+	return nil
+}
+
+// FailureCache remembers files which could not be decoded. Implementations
+// must be safe for concurrent use.
+type FailureCache interface {
+	// Failed reports whether decoding of a file with given size and
+	// modification time has failed before.
+	Failed(name string, size int64, mtime time.Time) bool
+	// PutFailed records that file could not be decoded.
+	PutFailed(name string, size int64, mtime time.Time, err error) error
+}
+
+// WithFailureCache makes Scanner record files it could not decode in cache,
+// and skip files cache reports as failed, unless they have changed since.
+func WithFailureCache(cache FailureCache) Option {
+	return func(c *config) { c.failures = cache }
+}
+
+// FailureLog is a FailureCache keeping its records in a text file, one
+// file per line.
+type FailureLog struct {
+	mu   sync.Mutex
+	f    *os.File
+	seen map[string]fileStamp
+}
+
+type fileStamp struct {
+	size  int64
+	mtime int64 // unix nanoseconds
+}
+
+// OpenFailureLog opens or creates file used to store failure records, and
+// loads records already stored there.
+func OpenFailureLog(name string) (*FailureLog, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	fl := &FailureLog{f: f, seen: make(map[string]fileStamp)}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// size<TAB>mtime<TAB>name<TAB>error
+		fields := strings.SplitN(sc.Text(), "\t", 4)
+		if len(fields) < 3 {
+			continue
+		}
+		size, err1 := strconv.ParseInt(fields[0], 10, 64)
+		mtime, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		fl.seen[fields[2]] = fileStamp{size: size, mtime: mtime}
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return fl, nil
+}
+
+// Failed implements FailureCache interface.
+func (fl *FailureLog) Failed(name string, size int64, mtime time.Time) bool {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	st, ok := fl.seen[name]
+	return ok && st == fileStamp{size: size, mtime: mtime.UnixNano()}
+}
+
+// PutFailed implements FailureCache interface.
+func (fl *FailureLog) PutFailed(name string, size int64, mtime time.Time, err error) error {
+	if strings.ContainsAny(name, "\t\n") {
+		return nil
+	}
+	msg := strings.Join(strings.Fields(err.Error()), " ")
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	st := fileStamp{size: size, mtime: mtime.UnixNano()}
+	fl.seen[name] = st
+	_, werr := fmt.Fprintf(fl.f, "%d\t%d\t%s\t%s\n", st.size, st.mtime, name, msg)
+	return werr
+}
+
+// Close closes underlying file.
+func (fl *FailureLog) Close() error { return fl.f.Close() }
@@ -0,0 +1,57 @@
+package similar
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithFileList makes Scanner process files listed in r instead of walking
+// the scanned directory, to scan a selection made by other tools, like find
+// or fd. Paths are separated by newlines, or by NUL characters if there are
+// any in the first 64 KiB of r, as find -print0 writes them. Symbolic links
+// are followed, as paths are listed explicitly. Listed files which are not
+// images by their name or content, like directories, are skipped;
+// WithExclude, WithMaxDepth and IgnoreFile don't apply. Only the first scan
+// reads r.
+func WithFileList(r io.Reader) Option { return func(c *config) { c.fileList = r } }
+
+// listHead is how much of a file list is looked at to choose separator
+const listHead = 64 << 10
+
+// listWalk calls fn for each file listed in r, see WithFileList, in the
+// order they are listed
+func listWalk(ctx context.Context, r io.Reader, fn filepath.WalkFunc) error {
+	rd := bufio.NewReaderSize(r, listHead)
+	sep := byte('\n')
+	if head, _ := rd.Peek(listHead); bytes.IndexByte(head, 0) >= 0 {
+		sep = 0
+	}
+	for {
+		p, err := rd.ReadString(sep)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		eof := err == io.EOF
+		p = strings.TrimSuffix(p, string(sep))
+		if sep == '\n' {
+			p = strings.TrimSuffix(p, "\r")
+		}
+		if p != "" {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			info, err := os.Stat(p)
+			if err := fn(p, info, err); err != nil {
+				return err
+			}
+		}
+		if eof {
+			return nil
+		}
+	}
+}
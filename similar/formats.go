@@ -0,0 +1,62 @@
+package similar
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/webp" // register webp decoder
+)
+
+// IsImage reports whether file name has an extension of an image format this
+// package decodes: jpeg, png, gif, webp or tiff, and heic or heif if package
+// is built with heif build tag, which requires libheif.
+func IsImage(name string) bool { return isImageExt(filepath.Ext(name)) }
+
+func isImageExt(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".tif", ".tiff":
+		return true
+	case ".heic", ".heif":
+		return heifSupported
+	}
+	return false
+}
+
+// heifBrands are ftyp box brands of HEIC/HEIF still images
+var heifBrands = []string{"heic", "heix", "heim", "heis", "mif1", "msf1"}
+
+// sniffImage reports whether named file content starts with a signature of
+// an image format IsImage recognizes.
+func sniffImage(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	b := make([]byte, 12)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return false
+	}
+	for _, sig := range [][]byte{
+		{0xff, 0xd8, 0xff},    // jpeg
+		[]byte("\x89PNG\r\n"), // png
+		[]byte("GIF8"),
+		[]byte("II*\x00"), // little endian tiff
+		[]byte("MM\x00*"), // big endian tiff
+	} {
+		if bytes.HasPrefix(b, sig) {
+			return true
+		}
+	}
+	if heifSupported && bytes.Equal(b[4:8], []byte("ftyp")) {
+		for _, brand := range heifBrands {
+			if string(b[8:]) == brand {
+				return true
+			}
+		}
+	}
+	return bytes.HasPrefix(b, []byte("RIFF")) && bytes.Equal(b[8:], []byte("WEBP"))
+}
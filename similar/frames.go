@@ -0,0 +1,66 @@
+package similar
+
+import (
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	"github.com/artyom/phash"
+)
+
+// FrameMatch describes a frame of an animated image similar to one of the
+// frames before it. Frames are numbered from 0.
+type FrameMatch struct {
+	Frame    int
+	Earlier  int // the closest earlier frame
+	Distance int
+}
+
+// DuplicateFrames decodes animated GIF from r and reports frames which are
+// within threshold distance of some earlier frame of the same animation.
+// Frames are hashed as displayed, i.e. composited over the preceding frames
+// according to their disposal methods.
+func DuplicateFrames(r io.Reader, opts ...Option) ([]FrameMatch, error) {
+	cfg := newConfig(opts)
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	hashes := make([]uint64, 0, len(g.Image))
+	var out []FrameMatch
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var prev *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			prev = image.NewRGBA(canvas.Rect)
+			copy(prev.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		hash, err := cfg.hashImage(canvas)
+		if err != nil {
+			return nil, err
+		}
+		best := FrameMatch{Frame: i, Earlier: -1, Distance: cfg.threshold + 1}
+		for j, h := range hashes {
+			if d := phash.Distance(hash, h); d < best.Distance {
+				best.Earlier, best.Distance = j, d
+			}
+		}
+		if best.Earlier >= 0 {
+			out = append(out, best)
+		}
+		hashes = append(hashes, hash)
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = prev
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,51 @@
+package similar
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// FuzzHashBytes checks that format sniffing decoder doesn't panic on
+// arbitrary input, and that hashes of inputs it accepts are stable.
+func FuzzHashBytes(f *testing.F) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 12))
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(16 * x), G: uint8(20 * y), B: 128, A: 255})
+		}
+	}
+	for _, enc := range []func(io.Writer, image.Image) error{
+		png.Encode,
+		func(w io.Writer, m image.Image) error { return jpeg.Encode(w, m, nil) },
+		func(w io.Writer, m image.Image) error { return gif.Encode(w, m, nil) },
+		func(w io.Writer, m image.Image) error { return tiff.Encode(w, m, nil) },
+	} {
+		var buf bytes.Buffer
+		if err := enc(&buf, img); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+		f.Add(buf.Bytes()[:buf.Len()/2]) // truncated
+	}
+	f.Add([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// limit keeps crafted headers from allocating gigabytes
+		hash, err := HashBytes(b, WithMaxPixels(1<<20))
+		if err != nil {
+			return
+		}
+		again, err := HashBytes(b, WithMaxPixels(1<<20))
+		if err != nil || again != hash {
+			t.Fatalf("second hash is %016x, %v; first one was %016x", again, err, hash)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package similar
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// GitBlob is an image stored in git repository history.
+type GitBlob struct {
+	Commit string // commit which introduced this blob
+	Path   string // path of the blob in that commit
+	ID     string // blob object name
+	Hash   uint64
+}
+
+// HashGitHistory hashes image blobs (see IsImage) ever added or modified in
+// any commit reachable from any ref of git repository at dir. It uses git
+// program, which should be available in PATH. Blobs are returned in order
+// of commits introducing them, oldest first; each blob is only reported
+// once, with the first commit and path it appeared under. Blobs that fail
+// to decode are skipped.
+func HashGitHistory(ctx context.Context, dir string, opts ...Option) ([]GitBlob, error) {
+	cfg := newConfig(opts)
+	blobs, err := gitBlobs(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "cat-file", "--batch")
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	out, err := cfg.hashBlobs(stdin, bufio.NewReader(stdout), blobs)
+	stdin.Close()
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("git cat-file: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// gitBlobs lists image blobs introduced by commits in repository at dir,
+// without hashes
+func gitBlobs(ctx context.Context, dir string) ([]GitBlob, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "-c", "core.quotePath=false",
+		"log", "--all", "--reverse", "--date-order", "--no-renames", "--raw", "--no-abbrev",
+		"--diff-filter=AM", "--format=commit %H")
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var blobs []GitBlob
+	var commit string
+	seen := make(map[string]struct{})
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "commit ") {
+			commit = line[len("commit "):]
+			continue
+		}
+		// :100644 100644 <old id> <new id> M<tab>path
+		if !strings.HasPrefix(line, ":") {
+			continue
+		}
+		i := strings.IndexByte(line, '\t')
+		if i < 0 {
+			return nil, fmt.Errorf("git log: unexpected line %q", line)
+		}
+		fields := strings.Fields(line[:i])
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("git log: unexpected line %q", line)
+		}
+		p, id := line[i+1:], fields[3]
+		if !isPage(p) {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		blobs = append(blobs, GitBlob{Commit: commit, Path: p, ID: id})
+	}
+	return blobs, nil
+}
+
+// hashBlobs requests blobs from git cat-file --batch process over w, reads
+// them from r and hashes them.
+func (cfg *config) hashBlobs(w io.Writer, r *bufio.Reader, blobs []GitBlob) ([]GitBlob, error) {
+	out := blobs[:0]
+	for _, blob := range blobs {
+		if _, err := io.WriteString(w, blob.ID+"\n"); err != nil {
+			return nil, err
+		}
+		// <id> blob <size>
+		hdr, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(hdr)
+		if len(fields) != 3 || fields[1] != "blob" {
+			return nil, fmt.Errorf("git cat-file: unexpected response %q", hdr)
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: unexpected response %q", hdr)
+		}
+		lr := io.LimitReader(r, size)
+		hash, err := cfg.hashReader(lr)
+		var derr *DecodeError
+		if err != nil && !errors.As(err, &derr) {
+			return nil, fmt.Errorf("%s: %w", blob.Path, err)
+		}
+		// skip what decoder left unread, and a newline following content
+		if _, err := io.Copy(io.Discard, lr); err != nil {
+			return nil, err
+		}
+		if _, err := r.Discard(1); err != nil {
+			return nil, err
+		}
+		if derr == nil {
+			blob.Hash = hash
+			out = append(out, blob)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,169 @@
+package similar
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/artyom/phash"
+	"github.com/disintegration/imaging"
+)
+
+var update = flag.Bool("update", false, "regenerate images in testdata/golden")
+
+const goldenDir = "testdata/golden"
+
+// writeGolden generates into goldenDir variants of the same picture: the
+// original, resized, recompressed with low JPEG quality and rotated, and an
+// unrelated picture.
+func writeGolden() error {
+	orig := picture(160, 120)
+	imgs := map[string]image.Image{
+		"original.png":     orig,
+		"resized.png":      imaging.Resize(orig, 80, 60, imaging.Lanczos),
+		"recompressed.jpg": orig,
+		"rotated.png":      imaging.Rotate90(orig),
+		"unrelated.png":    stripes(160, 120),
+	}
+	for name, img := range imgs {
+		if err := imaging.Save(img, filepath.Join(goldenDir, name), imaging.JPEGQuality(20)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// picture returns an image of a few shapes on a gradient
+func picture(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: uint8(255 * x / w), G: uint8(255 * y / h), B: 96, A: 255}
+			if dx, dy := x-w/3, y-h/2; dx*dx+dy*dy < h*h/9 {
+				c = color.NRGBA{R: 240, G: 230, B: 40, A: 255}
+			}
+			if x > 2*w/3 && x < 9*w/10 && y > h/5 && y < 3*h/4 {
+				c = color.NRGBA{R: 20, G: 30, B: 120, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// stripes returns an image of diagonal stripes
+func stripes(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(0)
+			if (x+2*y)/20%2 == 0 {
+				v = 220
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+// TestWriteGolden regenerates images in goldenDir when tests run with -update
+// flag.
+func TestWriteGolden(t *testing.T) {
+	if !*update {
+		t.Skip("run with -update to regenerate images")
+	}
+	if err := writeGolden(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGoldenDistances checks distances between golden images by each
+// algorithm, so that changes of preprocessing that make variants of the same
+// picture drift apart, or unrelated pictures come closer, don't go unnoticed.
+func TestGoldenDistances(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		algo     Algorithm
+		min, max int // distance range
+	}{
+		{"original.png", "resized.png", PHash, 0, 3},
+		{"original.png", "recompressed.jpg", PHash, 0, 3},
+		{"original.png", "rotated.png", PHash, 20, 64},
+		{"original.png", "unrelated.png", PHash, 20, 64},
+		{"original.png", "resized.png", DHash, 0, 3},
+		{"original.png", "recompressed.jpg", DHash, 0, 3},
+		{"original.png", "rotated.png", DHash, 20, 64},
+		{"original.png", "unrelated.png", DHash, 20, 64},
+		{"original.png", "resized.png", AHash, 0, 3},
+		{"original.png", "recompressed.jpg", AHash, 0, 3},
+		{"original.png", "rotated.png", AHash, 20, 64},
+		{"original.png", "unrelated.png", AHash, 20, 64},
+		{"original.png", "resized.png", WHash, 0, 3},
+		{"original.png", "recompressed.jpg", WHash, 0, 3},
+		{"original.png", "rotated.png", WHash, 20, 64},
+		{"original.png", "unrelated.png", WHash, 20, 64},
+	} {
+		t.Run(fmt.Sprintf("%s-%s-%v", tc.a, tc.b, tc.algo), func(t *testing.T) {
+			a, err := HashFile(filepath.Join(goldenDir, tc.a), WithAlgorithm(tc.algo))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := HashFile(filepath.Join(goldenDir, tc.b), WithAlgorithm(tc.algo))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := phash.Distance(a, b); d < tc.min || d > tc.max {
+				t.Fatalf("distance is %d, want %d..%d", d, tc.min, tc.max)
+			}
+		})
+	}
+}
+
+// TestGoldenMatches checks which golden images Scanner reports as similar
+// with default threshold.
+func TestGoldenMatches(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want []string // pairs, sorted
+	}{
+		{"default", nil, []string{
+			"original.png recompressed.jpg",
+			"original.png resized.png",
+			"recompressed.jpg resized.png",
+		}},
+		{"invariant", []Option{WithInvariant()}, []string{
+			"original.png recompressed.jpg",
+			"original.png resized.png",
+			"original.png rotated.png rotated 90° clockwise",
+			"recompressed.jpg resized.png",
+			"recompressed.jpg rotated.png rotated 90° clockwise",
+			"resized.png rotated.png rotated 90° clockwise",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			s := NewScanner(append(tc.opts, WithDeterministic())...)
+			err := s.Scan(context.Background(), goldenDir, func(p Pair) {
+				a, b := filepath.Base(p.Match.Name), filepath.Base(p.Name)
+				if a > b {
+					a, b = b, a
+				}
+				got = append(got, strings.TrimSpace(a+" "+b+" "+p.Transform))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Fatalf("got matches:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
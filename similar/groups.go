@@ -0,0 +1,59 @@
+package similar
+
+import "sort"
+
+// Groups collects similar image pairs into groups: two images are in the same
+// group if there is a chain of pairs connecting them. The zero value is an
+// empty Groups ready to use. Groups is not safe for concurrent use.
+type Groups struct {
+	parent  map[string]string // union-find forest over entry names
+	entries map[string]Entry
+}
+
+// Add records that images of the pair are similar.
+func (g *Groups) Add(p Pair) {
+	if g.parent == nil {
+		g.parent = make(map[string]string)
+		g.entries = make(map[string]Entry)
+	}
+	for _, e := range [...]Entry{p.Entry, p.Match.Entry} {
+		if _, ok := g.parent[e.Name]; !ok {
+			g.parent[e.Name] = e.Name
+			g.entries[e.Name] = e
+		}
+	}
+	a, b := g.find(p.Name), g.find(p.Match.Name)
+	if a != b {
+		g.parent[a] = b
+	}
+}
+
+func (g *Groups) find(name string) string {
+	root := name
+	for g.parent[root] != root {
+		root = g.parent[root]
+	}
+	for name != root { // path compression
+		next := g.parent[name]
+		g.parent[name] = root
+		name = next
+	}
+	return root
+}
+
+// List returns all groups, each having at least two entries. Entries of a
+// group are sorted by name, groups are sorted by name of their first entry.
+func (g *Groups) List() [][]Entry {
+	byRoot := make(map[string][]Entry)
+	for name, e := range g.entries {
+		root := g.find(name)
+		byRoot[root] = append(byRoot[root], e)
+	}
+	out := make([][]Entry, 0, len(byRoot))
+	for _, group := range byRoot {
+		sort.Slice(group, func(i, j int) bool { return group[i].Name < group[j].Name })
+		out = append(out, group)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i][0].Name < out[j][0].Name })
+	return out
+}
@@ -0,0 +1,175 @@
+package similar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/artyom/phash"
+)
+
+// maxMemory is how much of a multipart form Handler keeps in memory, the rest
+// is stored in temporary files
+const maxMemory = 32 << 20
+
+// Handler defaults, see WithMaxUpload and WithMaxPixels
+const (
+	defaultMaxUpload = 64 << 20
+	defaultMaxPixels = 100_000_000
+)
+
+// WithMaxUpload makes Handler reject requests which body is larger than n
+// bytes with 413 Request Entity Too Large status. Default is 64 MiB, 0
+// disables the limit.
+func WithMaxUpload(n int64) Option { return func(c *config) { c.maxUpload = n } }
+
+// Handler returns a handler rejecting uploads of images that are within
+// threshold (see WithThreshold) distance of images already in idx, and
+// passing all other requests to next.
+//
+// Image is taken either from request body, as in PUT uploads, or from file
+// parts of multipart/form-data body; the form is then already parsed when
+// next is called. Requests which body is not a decodable image are passed to
+// next as is. On a match Handler responds with 409 Conflict status, naming
+// the matching images. If next responds with a 2xx status, uploaded images
+// are added to idx, named by file names in multipart form, or by request URL
+// path. While next handles a request, its images are reserved, so that
+// concurrent uploads of near-duplicates of them are rejected too. Handler
+// serializes access to idx, so it should not be used elsewhere concurrently.
+//
+// Request bodies are limited to 64 MiB (see WithMaxUpload), and images of
+// more than 100 million pixels are not decoded (see WithMaxPixels), but
+// passed to next as is; options given override these defaults.
+func Handler(idx Index, next http.Handler, opts ...Option) http.Handler {
+	opts = append([]Option{WithMaxUpload(defaultMaxUpload), WithMaxPixels(defaultMaxPixels)}, opts...)
+	return &handler{cfg: newConfig(opts), idx: idx, next: next, pending: make(map[int][]Entry)}
+}
+
+type handler struct {
+	cfg  *config
+	next http.Handler
+
+	mu      sync.Mutex // guards fields below
+	idx     Index
+	pending map[int][]Entry // images of requests being handled by next
+	lastID  int             // of a pending request
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.maxUpload > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(w, r.Body, h.cfg.maxUpload)
+	}
+	entries, err := h.entries(r)
+	var tooBig *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooBig):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(entries) == 0 {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	id, matches := h.reserve(entries)
+	if len(matches) > 0 {
+		http.Error(w, "near-duplicate image upload: "+strings.Join(matches, ", "), http.StatusConflict)
+		return
+	}
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.pending, id)
+		if sw.status >= 200 && sw.status <= 299 {
+			for _, e := range entries {
+				h.idx.Add(e)
+			}
+		}
+	}()
+	h.next.ServeHTTP(sw, r)
+}
+
+// reserve looks up entries in idx and in pending requests. If nothing
+// matches, it adds entries to pending requests and returns their id,
+// otherwise it returns descriptions of matches.
+func (h *handler) reserve(entries []Entry) (int, []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var matches []string
+	for _, e := range entries {
+		for _, m := range h.idx.Search(e.Hash, h.cfg.threshold) {
+			matches = append(matches, fmt.Sprintf("%q is similar to %q (dist=%d)", e.Name, m.Name, m.Distance))
+		}
+		for _, p := range h.pending {
+			for _, pe := range p {
+				if d := phash.Distance(e.Hash, pe.Hash); d <= h.cfg.threshold {
+					matches = append(matches, fmt.Sprintf("%q is similar to %q being uploaded (dist=%d)", e.Name, pe.Name, d))
+				}
+			}
+		}
+	}
+	if len(matches) > 0 {
+		return 0, matches
+	}
+	h.lastID++
+	h.pending[h.lastID] = entries
+	return h.lastID, nil
+}
+
+// entries hashes images uploaded with request. Only errors reading request
+// are returned, images that fail to decode are skipped.
+func (h *handler) entries(r *http.Request) ([]Entry, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			return nil, err
+		}
+		var out []Entry
+		for _, files := range r.MultipartForm.File {
+			for _, fh := range files {
+				f, err := fh.Open()
+				if err != nil {
+					return nil, err
+				}
+				hash, err := h.cfg.hashReader(f)
+				f.Close()
+				if err == nil {
+					out = append(out, Entry{Name: fh.Filename, Hash: hash})
+				}
+			}
+		}
+		return out, nil
+	}
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	hash, err := h.cfg.hashReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil
+	}
+	return []Entry{{Name: r.URL.Path, Hash: hash}}, nil
+}
+
+// statusWriter records response status code.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,50 @@
+package similar
+
+import (
+	"context"
+	"sync"
+)
+
+// Result holds hashing outcome of a single file.
+type Result struct {
+	Path string
+	Hash uint64
+	Err  error // non-nil if file could not be read or decoded
+}
+
+// HashAll hashes files concurrently and returns results in the same order as
+// paths. Errors of individual files are reported in their Result.Err and do
+// not stop processing of other files. The only error HashAll returns is
+// ctx.Err() if context is canceled before all files are processed.
+func HashAll(ctx context.Context, paths []string, opts ...Option) ([]Result, error) {
+	cfg := newConfig(opts)
+	results := make([]Result, len(paths))
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				h, err := cfg.hashFile(paths[i])
+				results[i] = Result{Path: paths[i], Hash: h, Err: err}
+			}
+		}()
+	}
+	var err error
+loop:
+	for i := range paths {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		case ch <- i:
+		}
+	}
+	close(ch)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
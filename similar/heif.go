@@ -0,0 +1,112 @@
+//go:build heif
+// +build heif
+
+package similar
+
+/*
+#cgo pkg-config: libheif
+#include <stdlib.h>
+#include <libheif/heif.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"unsafe"
+)
+
+// heifSupported is set if package is built with heif tag, and links libheif
+// to decode HEIC/HEIF images
+const heifSupported = true
+
+func init() {
+	for _, brand := range heifBrands {
+		image.RegisterFormat("heif", "????ftyp"+brand, decodeHEIF, decodeHEIFConfig)
+	}
+}
+
+// heifContext holds libheif context reading a file, and its primary image
+type heifContext struct {
+	ctx    *C.struct_heif_context
+	handle *C.struct_heif_image_handle
+	data   unsafe.Pointer
+}
+
+func openHEIF(r io.Reader) (*heifContext, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("heif: empty file")
+	}
+	h := &heifContext{ctx: C.heif_context_alloc(), data: C.CBytes(b)}
+	if err := heifError(C.heif_context_read_from_memory_without_copy(h.ctx, h.data, C.size_t(len(b)), nil)); err != nil {
+		h.close()
+		return nil, err
+	}
+	if err := heifError(C.heif_context_get_primary_image_handle(h.ctx, &h.handle)); err != nil {
+		h.close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *heifContext) close() {
+	if h.handle != nil {
+		C.heif_image_handle_release(h.handle)
+	}
+	C.heif_context_free(h.ctx)
+	C.free(h.data)
+}
+
+// decodeHEIF decodes primary image of HEIC/HEIF file. Rotation and mirroring
+// stored in the file are applied by libheif.
+func decodeHEIF(r io.Reader) (image.Image, error) {
+	h, err := openHEIF(r)
+	if err != nil {
+		return nil, err
+	}
+	defer h.close()
+	var img *C.struct_heif_image
+	if err := heifError(C.heif_decode_image(h.handle, &img, C.heif_colorspace_RGB, C.heif_chroma_interleaved_RGBA, nil)); err != nil {
+		return nil, err
+	}
+	defer C.heif_image_release(img)
+	w := int(C.heif_image_get_width(img, C.heif_channel_interleaved))
+	ht := int(C.heif_image_get_height(img, C.heif_channel_interleaved))
+	var stride C.int
+	pix := C.heif_image_get_plane_readonly(img, C.heif_channel_interleaved, &stride)
+	if pix == nil || w <= 0 || ht <= 0 {
+		return nil, errors.New("heif: no image data")
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, w, ht))
+	src := unsafe.Slice((*byte)(unsafe.Pointer(pix)), int(stride)*ht)
+	for y := 0; y < ht; y++ {
+		copy(out.Pix[y*out.Stride:y*out.Stride+4*w], src[y*int(stride):])
+	}
+	return out, nil
+}
+
+func decodeHEIFConfig(r io.Reader) (image.Config, error) {
+	h, err := openHEIF(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer h.close()
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(C.heif_image_handle_get_width(h.handle)),
+		Height:     int(C.heif_image_handle_get_height(h.handle)),
+	}, nil
+}
+
+func heifError(err C.struct_heif_error) error {
+	if err.code == C.heif_error_Ok {
+		return nil
+	}
+	return errors.New("heif: " + C.GoString(err.message))
+}
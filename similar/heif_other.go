@@ -0,0 +1,8 @@
+//go:build !heif
+// +build !heif
+
+package similar
+
+// heifSupported is set if package is built with heif tag, and links libheif
+// to decode HEIC/HEIF images
+const heifSupported = false
@@ -0,0 +1,53 @@
+package similar
+
+import (
+	"github.com/artyom/phash-examples/similar/internal/bktree"
+)
+
+// Index keeps hashes of already seen images. Implementations are not required
+// to be safe for concurrent use.
+type Index interface {
+	// Add adds entry to the index.
+	Add(Entry)
+	// Search returns entries which hashes are within maxDist of hash.
+	Search(hash uint64, maxDist int) []Match
+}
+
+// NewIndex returns a new empty instance of the index Scanner uses by default.
+// It finds all entries within distance, including all entries with the same
+// hash.
+func NewIndex() Index { return &treeIndex{} }
+
+// Entry is an image known to the index.
+type Entry struct {
+	Name     string
+	Hash     uint64
+	Salvaged bool   // image was only partially decoded, see WithSalvage
+	Checksum []byte // file content checksum, see WithChecksum
+}
+
+// Match is an Entry found by Index.Search.
+type Match struct {
+	Entry
+	Distance int
+}
+
+// treeIndex keeps entries in a BK-tree, which is keyed by their positions in
+// a slice.
+type treeIndex struct {
+	tree    bktree.Tree
+	entries []Entry
+}
+
+func (x *treeIndex) Search(hash uint64, maxDist int) []Match {
+	var out []Match
+	x.tree.Search(hash, maxDist, func(id, dist int) {
+		out = append(out, Match{Entry: x.entries[id], Distance: dist})
+	})
+	return out
+}
+
+func (x *treeIndex) Add(e Entry) {
+	x.tree.Add(e.Hash, len(x.entries))
+	x.entries = append(x.entries, e)
+}
@@ -0,0 +1,83 @@
+// Package bktree implements a BK-tree: a metric tree of 64-bit hashes with
+// Hamming distance as a metric, allowing to find all hashes within given
+// distance of a query without comparing it against every stored hash.
+package bktree
+
+import "math/bits"
+
+// Tree is a BK-tree mapping hashes to integer ids. The zero value is an
+// empty tree ready to use. Tree is not safe for concurrent use.
+type Tree struct {
+	root *node
+}
+
+type node struct {
+	hash     uint64
+	ids      []int // ids added with this exact hash
+	children []child
+}
+
+type child struct {
+	dist int // distance between child and parent hashes
+	node *node
+}
+
+// Add stores id under hash. The same hash may be added many times.
+func (t *Tree) Add(hash uint64, id int) {
+	if t.root == nil {
+		t.root = &node{hash: hash, ids: []int{id}}
+		return
+	}
+	n := t.root
+	for {
+		d := distance(n.hash, hash)
+		if d == 0 {
+			n.ids = append(n.ids, id)
+			return
+		}
+		next := n.child(d)
+		if next == nil {
+			n.children = append(n.children, child{dist: d, node: &node{hash: hash, ids: []int{id}}})
+			return
+		}
+		n = next
+	}
+}
+
+// Search calls fn for every id stored under a hash within maxDist of hash,
+// along with that distance. Ids with equal hashes are reported in the order
+// they were added, otherwise order is unspecified.
+func (t *Tree) Search(hash uint64, maxDist int, fn func(id, dist int)) {
+	if t.root == nil {
+		return
+	}
+	stack := []*node{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := distance(n.hash, hash)
+		if d <= maxDist {
+			for _, id := range n.ids {
+				fn(id, d)
+			}
+		}
+		// by triangle inequality, only subtrees with distance to n in
+		// [d-maxDist, d+maxDist] can hold matches
+		for _, c := range n.children {
+			if c.dist >= d-maxDist && c.dist <= d+maxDist {
+				stack = append(stack, c.node)
+			}
+		}
+	}
+}
+
+func (n *node) child(dist int) *node {
+	for _, c := range n.children {
+		if c.dist == dist {
+			return c.node
+		}
+	}
+	return nil
+}
+
+func distance(a, b uint64) int { return bits.OnesCount64(a ^ b) }
@@ -0,0 +1,142 @@
+package bktree
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	flip := func(h uint64, n int) uint64 {
+		for i := 0; i < n; i++ {
+			h ^= 1 << uint(rnd.Intn(64))
+		}
+		return h
+	}
+	random := func(n int) []uint64 {
+		out := make([]uint64, n)
+		for i := range out {
+			out[i] = rnd.Uint64()
+		}
+		return out
+	}
+	same := func(h uint64, n int) []uint64 {
+		out := make([]uint64, n)
+		for i := range out {
+			out[i] = h
+		}
+		return out
+	}
+	clusters := func(n, size, spread int) []uint64 {
+		var out []uint64
+		for i := 0; i < n; i++ {
+			c := rnd.Uint64()
+			for j := 0; j < size; j++ {
+				out = append(out, flip(c, rnd.Intn(spread+1)))
+			}
+		}
+		return out
+	}
+	// every hash at a distinct distance from the first one, so that the
+	// tree degenerates into a chain
+	chain := func() []uint64 {
+		out := make([]uint64, 65)
+		for i := range out {
+			out[i] = 1<<uint(i) - 1
+		}
+		out[64] = ^uint64(0)
+		return out
+	}
+	for _, tc := range []struct {
+		name   string
+		hashes []uint64
+	}{
+		{"empty", nil},
+		{"random", random(2000)},
+		{"identical", same(0xdeadbeefcafe, 300)},
+		{"zero and ones", append(same(0, 50), same(^uint64(0), 50)...)},
+		{"duplicates", twice(random(200))},
+		{"clusters", clusters(20, 50, 3)},
+		{"tight clusters", clusters(5, 200, 1)},
+		{"chain", chain()},
+		{"chain reversed", reverse(chain())},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hashes := tc.hashes
+			var tree Tree
+			for id, h := range hashes {
+				tree.Add(h, id)
+			}
+			queries := append(random(20), 0, ^uint64(0))
+			for i := 0; i < len(hashes) && i < 20; i++ {
+				h := hashes[rnd.Intn(len(hashes))]
+				queries = append(queries, h, ^h, flip(h, 2))
+			}
+			for _, q := range queries {
+				for _, maxDist := range []int{0, 1, 3, 5, 10, 32, 63, 64} {
+					var got []result
+					tree.Search(q, maxDist, func(id, dist int) {
+						got = append(got, result{id, dist})
+					})
+					want := bruteForce(hashes, q, maxDist)
+					if err := compare(got, want); err != "" {
+						t.Fatalf("Search(%016x, %d): %s", q, maxDist, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSearchSameHashOrder(t *testing.T) {
+	var tree Tree
+	for id := 0; id < 100; id++ {
+		tree.Add(uint64(id%3), id)
+	}
+	last := map[int]int{} // by hash, last id reported
+	tree.Search(0, 64, func(id, _ int) {
+		if prev, ok := last[id%3]; ok && prev >= id {
+			t.Fatalf("id %d reported after %d", id, prev)
+		}
+		last[id%3] = id
+	})
+}
+
+type result struct{ id, dist int }
+
+func bruteForce(hashes []uint64, q uint64, maxDist int) []result {
+	var out []result
+	for id, h := range hashes {
+		if d := bits.OnesCount64(h ^ q); d <= maxDist {
+			out = append(out, result{id, d})
+		}
+	}
+	return out
+}
+
+// compare returns description of difference between search results, or an
+// empty string if they hold the same ids with the same distances
+func compare(got, want []result) string {
+	sort.Slice(got, func(i, j int) bool { return got[i].id < got[j].id })
+	if len(got) != len(want) {
+		return fmt.Sprintf("got %d results, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return fmt.Sprintf("got %+v, want %+v", got[i], want[i])
+		}
+	}
+	return ""
+}
+
+func twice(s []uint64) []uint64 { return append(s, s...) }
+
+func reverse(s []uint64) []uint64 {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+	return s
+}
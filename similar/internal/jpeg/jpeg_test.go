@@ -0,0 +1,100 @@
+package jpeg
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDecode checks that pixels of scaled image are means of 8×8 blocks of
+// image decoded at full size by image/jpeg. Only the first component is
+// compared, as others may be subsampled, and then are only kept at their
+// block resolution. Test images are from Go source tree,
+// src/image/testdata.
+func TestDecode(t *testing.T) {
+	names, err := filepath.Glob("testdata/*.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatal("no test images")
+	}
+	for _, name := range names {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			full, err := firstPlane(decodeFile(t, name, jpeg.Decode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := firstPlane(decodeFile(t, name, Decode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w, h := (full.w+7)/8, (full.h+7)/8; img.w != w || img.h != h {
+				t.Fatalf("got %d×%d image, want %d×%d", img.w, img.h, w, h)
+			}
+			var sum, worst int
+			for y := 0; y < img.h; y++ {
+				for x := 0; x < img.w; x++ {
+					var total, n int
+					for yy := 8 * y; yy < min(8*y+8, full.h); yy++ {
+						for xx := 8 * x; xx < min(8*x+8, full.w); xx++ {
+							total += int(full.at(xx, yy))
+							n++
+						}
+					}
+					d := int(img.at(x, y)) - (total+n/2)/n
+					d = max(d, -d)
+					sum += d
+					worst = max(worst, d)
+				}
+			}
+			// pixels of full size image are clipped to [0, 255], so blocks
+			// having clipped ones may differ noticeably
+			if mean := float64(sum) / float64(img.w*img.h); mean > 1 || worst > 24 {
+				t.Fatalf("pixels differ from block means by %.2f on average, up to %d", mean, worst)
+			}
+		})
+	}
+}
+
+// plane is a single color component of an image
+type plane struct {
+	w, h int
+	at   func(x, y int) uint8
+}
+
+func firstPlane(img image.Image) (plane, error) {
+	b := img.Bounds()
+	c := plane{w: b.Dx(), h: b.Dy()}
+	switch m := img.(type) {
+	case *image.Gray:
+		c.at = func(x, y int) uint8 { return m.Pix[m.PixOffset(x, y)] }
+	case *image.YCbCr:
+		c.at = func(x, y int) uint8 { return m.Y[m.YOffset(x, y)] }
+	case *image.CMYK:
+		c.at = func(x, y int) uint8 { return m.Pix[m.PixOffset(x, y)] }
+	case *image.RGBA:
+		c.at = func(x, y int) uint8 { return m.Pix[m.PixOffset(x, y)] }
+	default:
+		return c, fmt.Errorf("unexpected image type %T", img)
+	}
+	return c, nil
+}
+
+func decodeFile(t *testing.T, name string, decode func(io.Reader) (image.Image, error)) image.Image {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
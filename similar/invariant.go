@@ -0,0 +1,133 @@
+package similar
+
+import (
+	"image"
+	"math"
+)
+
+// WithInvariant makes Scanner also match images rotated by multiples of 90°
+// or mirrored: each scanned image is additionally hashed as if it was
+// transformed in each of these 7 ways, and matched on the smallest distance.
+// Such matches have Pair.Transform set. Transformed hashes are computed from
+// the same decoded image as the usual one, but are not cached, so images are
+// decoded even if their hashes are. It only works with PHash algorithm, and is
+// ignored with others.
+func WithInvariant() Option { return func(c *config) { c.invariant = true } }
+
+// transforms are names of image transformations invariantHashes returns
+// hashes for, indexed by combination of mirrorX, mirrorY and transpose bits
+var transforms = [8]string{
+	"",
+	"mirrored",
+	"flipped upside down",
+	"rotated 180°",
+	"transposed",
+	"rotated 90° clockwise",
+	"rotated 90° counterclockwise",
+	"transversed",
+}
+
+const (
+	mirrorX   = 1 << iota // left to right
+	mirrorY               // top to bottom
+	transpose             // along the main diagonal, applied first
+)
+
+// invariantHashes returns hashes of img transformed in each way listed in
+// transforms, the first one being the same hash hashImage returns. It
+// returns false if algorithm is not PHash.
+//
+// Rather than transforming image 8 times, it computes the low frequency DCT
+// coefficients phash uses once, as transforms of the image map to
+// transforms of its coefficients: mirroring negates coefficients of odd
+// frequencies along that axis, and transposing transposes them.
+func (cfg *config) invariantHashes(img image.Image) ([8]uint64, bool) {
+	if cfg.algo != PHash {
+		return [8]uint64{}, false
+	}
+	if cfg.crop != nil {
+		var err error
+		if img, err = cfg.cropImage(img); err != nil {
+			return [8]uint64{}, false
+		}
+	}
+	if img = cfg.preprocess(img); img.Bounds().Dx() != hashSize || img.Bounds().Dy() != hashSize {
+		img = cfg.resize(img, hashSize, hashSize)
+	}
+	coef := lowDCT(toGray(img, LumaRec601))
+	var out [8]uint64
+	for t := range out {
+		var m [8][8]float64
+		var total float64
+		for u := range m {
+			for v := range m[u] {
+				c := coef[u][v]
+				if t&transpose != 0 {
+					c = coef[v][u]
+				}
+				if t&mirrorX != 0 && u%2 == 1 {
+					c = -c
+				}
+				if t&mirrorY != 0 && v%2 == 1 {
+					c = -c
+				}
+				m[u][v] = c
+				total += c
+			}
+		}
+		// same as phash: bits are set for coefficients above the mean of
+		// all but the DC one, most significant bit first
+		mean := (total - m[0][0]) / 63
+		for u := range m {
+			for v := range m[u] {
+				if m[u][v] > mean {
+					out[t] |= 1 << uint(63-(8*u+v))
+				}
+			}
+		}
+	}
+	return out, true
+}
+
+// dctBasis[u][i] is the orthonormal DCT-II basis value for frequency u at
+// sample i of hashSize samples
+var dctBasis = func() (b [8][hashSize]float64) {
+	for u := range b {
+		scale := math.Sqrt(2.0 / hashSize)
+		if u == 0 {
+			scale = 1 / math.Sqrt(hashSize)
+		}
+		for i := range b[u] {
+			b[u][i] = scale * math.Cos(float64((2*i+1)*u)*math.Pi/(2*hashSize))
+		}
+	}
+	return b
+}()
+
+// lowDCT returns 8×8 lowest frequency DCT coefficients of hashSize×hashSize
+// grayscale image, indexed by horizontal frequency first, as phash computes
+// them, but separably.
+func lowDCT(img *image.Gray) [8][8]float64 {
+	var rows [8][hashSize]float64 // 1D DCT of each row, along x
+	for y := 0; y < hashSize; y++ {
+		row := img.Pix[y*img.Stride:]
+		for u := range rows {
+			var sum float64
+			for x, c := range dctBasis[u] {
+				sum += float64(uint32(row[x])*0x101) * c
+			}
+			rows[u][y] = sum
+		}
+	}
+	var out [8][8]float64
+	for u := range out {
+		for v := range out[u] {
+			var sum float64
+			for y, c := range dctBasis[v] {
+				sum += rows[u][y] * c
+			}
+			out[u][v] = sum
+		}
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package similar
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+)
+
+// WithMaxPixels makes images of more than n pixels fail with
+// *TooLargeError, before they are decoded. Decoding an image holds all of
+// its pixels in memory, several bytes per pixel, so this bounds memory each
+// worker uses. Scanner skips such images, passing errors to WithErrorHandler
+// function if set. Default is no limit.
+func WithMaxPixels(n int) Option { return func(c *config) { c.maxPixels = n } }
+
+// TooLargeError is returned for images exceeding WithMaxPixels limit.
+type TooLargeError struct {
+	Width, Height int
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("image is too large: %d×%d pixels", e.Width, e.Height)
+}
+
+// checkSize reads image header from r, and returns an error if image is over
+// maxPixels limit. Otherwise it returns reader with the same data as r had.
+// Images which header can't be decoded are left for decoder to fail on.
+func (cfg *config) checkSize(r io.Reader) (io.Reader, error) {
+	var head bytes.Buffer
+	ic, _, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err == nil && ic.Width*ic.Height > cfg.maxPixels {
+		return nil, &TooLargeError{Width: ic.Width, Height: ic.Height}
+	}
+	return io.MultiReader(&head, r), nil
+}
@@ -0,0 +1,66 @@
+package similar
+
+// Signature is a MinHash signature of a set of image hashes. Signatures of
+// two sets allow to estimate their Jaccard similarity (size of intersection
+// divided by size of union) without comparing the sets themselves.
+type Signature [64]uint64
+
+// MinHash computes a signature of a set of image hashes. Order of hashes and
+// duplicates do not matter.
+func MinHash(hashes []uint64) Signature {
+	var sig Signature
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for _, h := range hashes {
+		for i := range sig {
+			if v := mix(h ^ minHashSeeds[i]); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// Similarity returns estimated Jaccard similarity of sets signatures were
+// computed for.
+func (s *Signature) Similarity(other *Signature) float64 {
+	var n int
+	for i := range s {
+		if s[i] == other[i] {
+			n++
+		}
+	}
+	return float64(n) / float64(len(s))
+}
+
+// Bands splits signature into 32 bands of 2 values each, and returns hashes
+// of these bands. Signatures of similar sets are likely to have at least one
+// band hash at the same position equal, so bands can be used as keys of a
+// hash table to find candidate pairs, without comparing all signatures
+// against each other (locality-sensitive hashing).
+func (s *Signature) Bands() [32]uint64 {
+	var out [32]uint64
+	for i := range out {
+		out[i] = mix(s[2*i] ^ mix(s[2*i+1]))
+	}
+	return out
+}
+
+var minHashSeeds = func() [64]uint64 {
+	var out [64]uint64
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range out {
+		x = mix(x)
+		out[i] = x
+	}
+	return out
+}()
+
+// mix is a splitmix64 finalizer
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
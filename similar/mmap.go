@@ -0,0 +1,51 @@
+package similar
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// WithMmap makes functions reading image files map them into memory instead
+// of reading them into buffers, saving a copy and many read calls on large
+// files on fast local storage. Files that cannot be mapped, such as empty
+// ones or those on file systems without mmap support, are read as usual.
+// On platforms without mmap this option has no effect.
+//
+// If a mapped file is truncated while being read, the read fails with an
+// error instead of crashing the program.
+func WithMmap() Option {
+	return func(c *config) { c.mmap = true }
+}
+
+// mapFile maps content of f into memory, ok is false if that is not
+// possible. Mapping must be released by calling unmap once data is no longer
+// needed.
+func mapFile(f *os.File) (data []byte, unmap func(), ok bool) {
+	st, err := f.Stat()
+	if err != nil || !st.Mode().IsRegular() || st.Size() <= 0 || int64(int(st.Size())) != st.Size() {
+		return nil, nil, false
+	}
+	data, err = mmap(f, int(st.Size()))
+	if err != nil {
+		return nil, nil, false
+	}
+	return data, func() { munmap(data) }, true
+}
+
+// withFaults calls fn, converting memory faults caused by accessing files
+// mapped with mapFile that shrunk after being mapped into an error.
+func withFaults(fn func() error) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(interface{ Addr() uintptr }); !ok {
+			panic(r)
+		}
+		err = fmt.Errorf("reading mapped file: %v", r)
+	}()
+	return fn()
+}
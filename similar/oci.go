@@ -0,0 +1,131 @@
+package similar
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Asset is an image bundled inside a container image layer.
+type Asset struct {
+	Layer string // layer name: tarball member name or blob path
+	Name  string // file path inside layer
+	Size  int64
+	Hash  uint64
+}
+
+// HashContainerImage hashes images (see IsImage) stored in container image
+// layers. Name is either a tarball, as produced by "docker save" or holding
+// an OCI image layout, or a directory with layer blobs, such as containerd
+// content store (/var/lib/containerd/io.containerd.content.v1.content).
+//
+// Every tarball member or file in a directory that is an uncompressed or
+// gzip-compressed tar archive is treated as a layer, anything else, like
+// manifests and configs, is ignored. Images that fail to decode and whiteout
+// files are skipped.
+func HashContainerImage(name string, opts ...Option) ([]Asset, error) {
+	cfg := newConfig(opts)
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	var assets []Asset
+	if !fi.IsDir() {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return assets, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			if assets, err = cfg.hashLayer(assets, hdr.Name, tr); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	err = filepath.Walk(name, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		layer, err := filepath.Rel(name, p)
+		if err != nil {
+			return err
+		}
+		assets, err = cfg.hashLayer(assets, filepath.ToSlash(layer), f)
+		return err
+	})
+	return assets, err
+}
+
+// hashLayer appends assets found in layer read from r to dst, and returns
+// extended slice. If r is not a tar archive, dst is returned as is.
+func (cfg *config) hashLayer(dst []Asset, layer string, r io.Reader) ([]Asset, error) {
+	r, ok, err := layerReader(r)
+	if err != nil || !ok {
+		return dst, err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", layer, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !isPage(hdr.Name) ||
+			strings.HasPrefix(filepath.Base(hdr.Name), ".wh.") {
+			continue
+		}
+		hash, err := cfg.hashReader(tr)
+		var derr *DecodeError
+		if errors.As(err, &derr) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", layer, hdr.Name, err)
+		}
+		dst = append(dst, Asset{Layer: layer, Name: hdr.Name, Size: hdr.Size, Hash: hash})
+	}
+}
+
+// layerReader detects whether r holds a tar archive, optionally gzip
+// compressed, and returns reader of uncompressed archive.
+func layerReader(r io.Reader) (io.Reader, bool, error) {
+	const tarMagicEnd = 262 // "ustar" magic is at offset 257
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(2); err == nil && b[0] == 0x1f && b[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, false, nil
+		}
+		br = bufio.NewReader(zr)
+	}
+	b, err := br.Peek(tarMagicEnd)
+	if err != nil || !bytes.HasPrefix(b[257:], []byte("ustar")) {
+		return nil, false, nil
+	}
+	return br, true, nil
+}
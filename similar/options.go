@@ -0,0 +1,143 @@
+package similar
+
+import (
+	"hash"
+	"image"
+	"io"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultThreshold is a default phash distance similarity threshold: images
+// with phash distance equal or below it are treated as likely duplicates.
+const DefaultThreshold = 5
+
+// Option configures optional behavior of functions in this package.
+type Option func(*config)
+
+type config struct {
+	workers   int
+	threshold int
+	decoder   Decoder
+	index     Index
+	cache     Cache
+	failures  FailureCache
+	onError   func(name string, err error)
+	crop      *image.Rectangle
+	luma      Luma
+	algo      Algorithm
+	normalize bool
+	watermark bool
+	salvage   bool
+	settle    time.Duration
+	checksum  func() hash.Hash
+	mmap      bool
+	maxPixels int
+	maxUpload int64
+	scaled    bool
+
+	rawOrientation bool
+	invariant      bool
+	tileGrid       int
+	tileVotes      float64
+
+	videoInterval time.Duration
+	videoCrop     float64
+
+	autoWorkers   int
+	lookahead     int // -1 means default
+	spillDir      string
+	deterministic bool
+	exclude       []string
+	maxDepth      int // -1 means no limit
+	bulkStat      bool
+	spotlight     bool
+	fileList      io.Reader
+	order         Order
+
+	stats *counters      // nil unless used by Scanner
+	stage *stageCounters // nil unless used by Scanner worker
+
+	// if set, hashReader calls it with each image it decodes, and its EXIF
+	// orientation if rawOrientation is set, see Scanner.extraHashes
+	decoded func(img image.Image, orientation int)
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		workers:   DefaultWorkers(),
+		threshold: DefaultThreshold,
+		decoder:   decode,
+		lookahead: -1,
+		maxDepth:  -1,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.deterministic {
+		cfg.workers, cfg.autoWorkers = 1, 0
+	}
+	return cfg
+}
+
+// WithWorkers sets the number of images processed concurrently. Values below
+// 1 are ignored. Default is DefaultWorkers().
+func WithWorkers(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.workers = n
+		}
+	}
+}
+
+// WithDeterministic makes processing order, and so the order in which
+// results are reported, stable between runs over the same files: directories
+// are walked in lexical order and files are processed by a single worker.
+// It overrides WithWorkers and WithAutoWorkers.
+func WithDeterministic() Option { return func(c *config) { c.deterministic = true } }
+
+// WithThreshold sets maximum phash distance at which images are reported as
+// similar. Negative values are ignored. Default is DefaultThreshold.
+func WithThreshold(n int) Option {
+	return func(c *config) {
+		if n >= 0 {
+			c.threshold = n
+		}
+	}
+}
+
+// Decoder decodes image from r.
+type Decoder func(r io.Reader) (image.Image, error)
+
+// WithDecoder sets function used to decode images. Default decoder detects
+// format from content and honors EXIF orientation of JPEG images.
+func WithDecoder(fn Decoder) Option {
+	return func(c *config) {
+		if fn != nil {
+			c.decoder = fn
+		}
+	}
+}
+
+// WithIndex sets index Scanner uses to keep track of seen images. By default
+// a new in-memory index is created for each Scanner.
+func WithIndex(idx Index) Option { return func(c *config) { c.index = idx } }
+
+// WithCache sets cache used to look up hashes of files that have not changed
+// since they were last hashed. By default no cache is used.
+func WithCache(cache Cache) Option { return func(c *config) { c.cache = cache } }
+
+// Cache stores previously calculated hashes. Implementations must be safe for
+// concurrent use.
+type Cache interface {
+	// Get returns hash stored for file if file size and modification time
+	// match the stored ones.
+	Get(name string, size int64, mtime time.Time) (hash uint64, ok bool)
+	// Put stores hash of a file.
+	Put(name string, size int64, mtime time.Time, hash uint64) error
+}
+
+func decode(r io.Reader) (image.Image, error) {
+	return imaging.Decode(r, imaging.AutoOrientation(true))
+}
@@ -0,0 +1,81 @@
+package similar
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+// Order is the order in which Scanner processes files.
+type Order int
+
+const (
+	// OrderWalk processes files as directory walk finds them. This is the
+	// default.
+	OrderWalk Order = iota
+	// OrderSizeDesc processes largest files first.
+	OrderSizeDesc
+	// OrderMtimeDesc processes most recently modified files first.
+	OrderMtimeDesc
+	// OrderRandom processes files in random order.
+	OrderRandom
+)
+
+func (o Order) String() string {
+	switch o {
+	case OrderWalk:
+		return "walk"
+	case OrderSizeDesc:
+		return "size-desc"
+	case OrderMtimeDesc:
+		return "mtime-desc"
+	case OrderRandom:
+		return "random"
+	}
+	return fmt.Sprintf("Order(%d)", int(o))
+}
+
+// ParseOrder parses Order from its string representation: "walk",
+// "size-desc", "mtime-desc" or "random".
+func ParseOrder(s string) (Order, error) {
+	for o := OrderWalk; o <= OrderRandom; o++ {
+		if o.String() == s {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown order %q", s)
+}
+
+// Set implements flag.Value interface.
+func (o *Order) Set(s string) error {
+	v, err := ParseOrder(s)
+	if err != nil {
+		return err
+	}
+	*o = v
+	return nil
+}
+
+// WithOrder sets the order in which Scanner processes files. Any order but
+// OrderWalk requires listing the whole tree before processing the first
+// file, keeping all found files in memory. Default is OrderWalk.
+func WithOrder(o Order) Option { return func(c *config) { c.order = o } }
+
+// walkItem is a file found by walk
+type walkItem struct {
+	name string
+	info os.FileInfo
+}
+
+// sortItems sorts files according to o
+func sortItems(items []walkItem, o Order) {
+	switch o {
+	case OrderSizeDesc:
+		sort.SliceStable(items, func(i, j int) bool { return items[i].info.Size() > items[j].info.Size() })
+	case OrderMtimeDesc:
+		sort.SliceStable(items, func(i, j int) bool { return items[i].info.ModTime().After(items[j].info.ModTime()) })
+	case OrderRandom:
+		rand.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+	}
+}
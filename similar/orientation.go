@@ -0,0 +1,51 @@
+package similar
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// WithRawOrientation makes Scanner also hash jpeg images that have EXIF
+// orientation set ignoring it, as their pixels are stored, so that copies
+// which lost orientation tag, and so are displayed rotated or mirrored, still
+// match them. Such matches have Pair.RawOrientation set. Raw hashes are not
+// cached, so images with orientation are decoded even if their hashes are.
+// Raw image is restored from the decoded one by undoing its orientation, so
+// decoder set by WithDecoder must honor it, as the default one does.
+func WithRawOrientation() Option { return func(c *config) { c.rawOrientation = true } }
+
+// exifHead is how much of a jpeg file is read looking for EXIF orientation:
+// a jpeg APP1 segment is at most 64 KiB
+const exifHead = 64<<10 + 4
+
+// rawHash returns hash of img, decoded honoring EXIF orientation, as its
+// pixels are stored. It returns false if orientation is the default one, so
+// that raw hash would be the same as the usual one.
+func (cfg *config) rawHash(img image.Image, orientation int) (uint64, bool) {
+	// inverse of transforms imaging.AutoOrientation applies
+	switch orientation {
+	case 2:
+		img = imaging.FlipH(img)
+	case 3:
+		img = imaging.Rotate180(img)
+	case 4:
+		img = imaging.FlipV(img)
+	case 5:
+		img = imaging.Transpose(img)
+	case 6:
+		img = imaging.Rotate90(img)
+	case 7:
+		img = imaging.Transverse(img)
+	case 8:
+		img = imaging.Rotate270(img)
+	default:
+		return 0, false
+	}
+	hash, err := cfg.hashImage(img)
+	return hash, err == nil
+}
+
+// exifOrientation returns value of EXIF orientation tag of jpeg image which
+// beginning is in b, or 0 if there's none
+func exifOrientation(b []byte) int { return parseExif(b).Orientation }
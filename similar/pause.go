@@ -0,0 +1,40 @@
+package similar
+
+import "context"
+
+// Pause makes Scanner stop taking new files for processing until Resume is
+// called. Files already being processed are finished. Pause and Resume are
+// safe to call at any time, including while Scan is in progress.
+func (s *Scanner) Pause() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	if s.resumed == nil {
+		s.resumed = make(chan struct{})
+	}
+}
+
+// Resume undoes the effect of Pause.
+func (s *Scanner) Resume() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+	}
+}
+
+// waitResumed blocks while Scanner is paused.
+func (s *Scanner) waitResumed(ctx context.Context) error {
+	s.pauseMu.Lock()
+	ch := s.resumed
+	s.pauseMu.Unlock()
+	if ch == nil {
+		return nil
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
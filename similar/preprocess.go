@@ -0,0 +1,174 @@
+package similar
+
+import (
+	"fmt"
+	"image"
+)
+
+// Luma is a method of converting colors to grayscale before hashing. Hashes
+// computed with different methods for the same color image usually differ in
+// a few bits, so matching hashes computed by other tools may require picking
+// the same method they use.
+type Luma int
+
+const (
+	// LumaRec601 weights color channels as 0.299R + 0.587G + 0.114B, the
+	// same way image/color.GrayModel does. This is the default.
+	LumaRec601 Luma = iota
+	// LumaRec709 weights color channels as 0.2126R + 0.7152G + 0.0722B.
+	LumaRec709
+	// LumaAverage weights all color channels equally.
+	LumaAverage
+)
+
+func (l Luma) String() string {
+	switch l {
+	case LumaRec601:
+		return "601"
+	case LumaRec709:
+		return "709"
+	case LumaAverage:
+		return "avg"
+	}
+	return fmt.Sprintf("Luma(%d)", int(l))
+}
+
+// ParseLuma parses Luma from its string representation: "601", "709" or
+// "avg".
+func ParseLuma(s string) (Luma, error) {
+	for l := LumaRec601; l <= LumaAverage; l++ {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown luma method %q", s)
+}
+
+// Set implements flag.Value interface.
+func (l *Luma) Set(s string) error {
+	v, err := ParseLuma(s)
+	if err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// WithLuma sets method of grayscale conversion. Default is LumaRec601.
+func WithLuma(l Luma) Option { return func(c *config) { c.luma = l } }
+
+// WithNormalize enables histogram equalization of grayscale image before
+// hashing. This makes hashes more robust against brightness and contrast
+// edits, but changes hash values, so hashes computed with and without it are
+// not comparable.
+func WithNormalize() Option { return func(c *config) { c.normalize = true } }
+
+// WithWatermarkMask makes hashing ignore image regions where watermarks are
+// usually placed: corners and a strip along the bottom edge. This helps to
+// match watermarked copies with their clean originals, but changes hash
+// values, so hashes computed with and without it are not comparable.
+func WithWatermarkMask() Option { return func(c *config) { c.watermark = true } }
+
+// hashSize is the image size phash.Get works with
+const hashSize = 32
+
+// preprocess scales image down to hashSize×hashSize, converts it to
+// grayscale, masks and normalizes it if non-default conversion, masking or
+// normalization is configured. Otherwise image is returned as is, leaving
+// both scaling and conversion to phash.Get.
+func (cfg *config) preprocess(img image.Image) image.Image {
+	if cfg.luma == LumaRec601 && !cfg.normalize && !cfg.watermark {
+		return img
+	}
+	return cfg.gray(img)
+}
+
+// gray scales image down to hashSize×hashSize and converts it to grayscale,
+// masking and normalizing it as configured.
+func (cfg *config) gray(img image.Image) *image.Gray {
+	gray := toGray(cfg.resize(img, hashSize, hashSize), cfg.luma)
+	if cfg.watermark {
+		maskWatermark(gray)
+	}
+	if cfg.normalize {
+		equalize(gray)
+	}
+	return gray
+}
+
+// equalize does histogram equalization of img in place.
+func equalize(img *image.Gray) {
+	var hist [256]int
+	for _, v := range img.Pix {
+		hist[v]++
+	}
+	var cdf [256]int
+	var sum, cdfMin int
+	for i, n := range hist {
+		sum += n
+		cdf[i] = sum
+		if cdfMin == 0 {
+			cdfMin = sum
+		}
+	}
+	if sum == cdfMin { // single color image
+		return
+	}
+	for i, v := range img.Pix {
+		img.Pix[i] = uint8((cdf[v] - cdfMin) * 255 / (sum - cdfMin))
+	}
+}
+
+// toGray converts image to grayscale using given luma method. Semi-transparent
+// pixels are treated as drawn over black background.
+func toGray(img image.Image, l Luma) *image.Gray {
+	b := img.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	var wr, wg, wb uint32 // weights, sum to 1<<16
+	switch l {
+	case LumaRec709:
+		wr, wg, wb = 13933, 46871, 4732
+	case LumaAverage:
+		wr, wg, wb = 21845, 21846, 21845
+	default:
+		wr, wg, wb = 19595, 38470, 7471
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			dst.Pix[(y-b.Min.Y)*dst.Stride+(x-b.Min.X)] = uint8((wr*r + wg*g + wb*bl + 1<<15) >> 24)
+		}
+	}
+	return dst
+}
+
+// maskWatermark fills corners and bottom strip of a hashSize×hashSize image
+// with the mean value of the remaining pixels, so that whatever is drawn
+// there doesn't affect the hash.
+func maskWatermark(img *image.Gray) {
+	const corner = hashSize / 4 // side of a masked corner square
+	const strip = hashSize / 8  // height of a masked bottom strip
+	masked := func(x, y int) bool {
+		if y >= hashSize-strip {
+			return true
+		}
+		return (x < corner || x >= hashSize-corner) && (y < corner || y >= hashSize-corner)
+	}
+	var sum, n int
+	for y := 0; y < hashSize; y++ {
+		for x := 0; x < hashSize; x++ {
+			if !masked(x, y) {
+				sum += int(img.Pix[y*img.Stride+x])
+				n++
+			}
+		}
+	}
+	mean := uint8(sum / n)
+	for y := 0; y < hashSize; y++ {
+		for x := 0; x < hashSize; x++ {
+			if masked(x, y) {
+				img.Pix[y*img.Stride+x] = mean
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package similar
+
+import (
+	"bytes"
+	"errors"
+	"image/jpeg"
+	"io"
+	"time"
+)
+
+// WithSalvage makes Scanner hash truncated JPEG images too: whatever part of
+// the image can be decoded is hashed, with the missing part filled in by the
+// decoder as flat blocks. Such images are reported with Entry.Salvaged set.
+// This allows matching partially corrupted copies against their intact
+// originals, but since a salvaged image is only partially correct, its
+// matches are less reliable.
+//
+// Salvaged hashes are not stored in a Cache. Unless WithMaxPixels sets a
+// limit, images of more than 2^27 pixels fail with *TooLargeError.
+func WithSalvage() Option { return func(c *config) { c.salvage = true } }
+
+// hashFileSalvage is like hashFileChecksum, but if file is a JPEG image that
+// fails to decode, it makes another attempt with the data padded as if the
+// rest of the image was present.
+func (cfg *config) hashFileSalvage(name string) (hash uint64, salvaged bool, sum []byte, err error) {
+	f, err := cfg.open(name)
+	if err != nil {
+		return 0, false, nil, err
+	}
+	defer f.Close()
+	if cfg.mmap {
+		if data, unmap, ok := mapFile(f); ok {
+			defer unmap()
+			err := withFaults(func() (err error) {
+				sum = cfg.sum(data)
+				hash, salvaged, err = cfg.hashDataSalvage(data)
+				return err
+			})
+			return hash, salvaged, sum, err
+		}
+	}
+	start := time.Now()
+	data, err := io.ReadAll(f)
+	if cfg.stage != nil {
+		since(&cfg.stage.open, start)
+	}
+	if err != nil {
+		return 0, false, nil, err
+	}
+	sum = cfg.sum(data)
+	hash, salvaged, err = cfg.hashDataSalvage(data)
+	return hash, salvaged, sum, err
+}
+
+// sum returns checksum of data, or nil if no checksum is configured
+func (cfg *config) sum(data []byte) []byte {
+	if cfg.checksum == nil {
+		return nil
+	}
+	h := cfg.checksum()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// maxSalvagePixels limits size of images hashed with salvage, unless
+// WithMaxPixels sets another limit: padded data decodes to the whole image,
+// however little of it the truncated file has.
+const maxSalvagePixels = 1 << 27
+
+func (cfg *config) hashDataSalvage(data []byte) (hash uint64, salvaged bool, err error) {
+	if cfg.maxPixels <= 0 {
+		c := *cfg
+		c.maxPixels = maxSalvagePixels
+		cfg = &c
+	}
+	hash, err = cfg.hashReader(bytes.NewReader(data))
+	var derr *DecodeError
+	if err == nil || !errors.As(err, &derr) {
+		return hash, false, err
+	}
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return 0, false, err
+	}
+	jcfg, err2 := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err2 != nil {
+		return 0, false, err
+	}
+	// how many bytes of zeros decode to a block depends on huffman tables,
+	// with standard tables it's about 0.5 byte per pixel; if padding is not
+	// enough, decoder hits end of image marker too early, so retry with
+	// more padding, up to maxPadding: files with so little data left are
+	// not worth salvaging
+	padding := jcfg.Width*jcfg.Height/4 + 1024
+	maxPadding := 16*len(data) + 1<<20
+	for i := 0; i < 4; i++ {
+		if padding > maxPadding {
+			padding = maxPadding
+		}
+		if hash, err2 := cfg.hashReader(bytes.NewReader(padJPEG(data, padding))); err2 == nil {
+			return hash, true, nil
+		}
+		if padding == maxPadding {
+			break
+		}
+		padding *= 2
+	}
+	return 0, false, err
+}
+
+// padJPEG returns data of a truncated JPEG image followed by padding zero
+// bytes, to be decoded as the remaining entropy-coded blocks, and the end of
+// image marker.
+func padJPEG(data []byte, padding int) []byte {
+	out := make([]byte, len(data)+padding, len(data)+padding+2)
+	copy(out, data)
+	return append(out, 0xff, 0xd9)
+}
@@ -0,0 +1,71 @@
+package similar
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+
+	"github.com/disintegration/imaging"
+
+	scaledjpeg "github.com/artyom/phash-examples/similar/internal/jpeg"
+)
+
+// WithScaledDecode makes JPEG images at least 8×scaledSide pixels on each
+// side decoded at 1/8 of their size, straight from the DCT coefficients
+// they are stored as, instead of being decoded at full size and then scaled
+// down for hashing. Memory each worker needs to decode them is then about
+// 1/64 of the full size image, and decoding is several times faster. Hashes
+// of such images may differ from those of full size decoded ones by a few
+// bits, so they should not be mixed in a Cache. Such images are decoded by
+// a built-in decoder, not the one set by WithDecoder, which still decodes
+// the others. Images are decoded at full size if WithCrop is set, as crop
+// rectangle is in pixels of the full size image.
+func WithScaledDecode() Option { return func(c *config) { c.scaled = true } }
+
+// scaledSide is the smallest side of an image decoded with WithScaledDecode,
+// so that scaled images still have enough detail for hashing
+const scaledSide = 256
+
+// decode decodes image from r with decoder, or at 1/8 of its size, see
+// WithScaledDecode
+func (cfg *config) decode(r io.Reader) (image.Image, error) {
+	if !cfg.scaled || cfg.crop != nil {
+		return cfg.decoder(r)
+	}
+	br := bufio.NewReaderSize(r, exifHead)
+	head, _ := br.Peek(exifHead)
+	if !bytes.HasPrefix(head, []byte{0xff, 0xd8}) {
+		return cfg.decoder(br)
+	}
+	// header may be past exifHead, after large metadata segments
+	var buf bytes.Buffer
+	ic, err := jpeg.DecodeConfig(io.TeeReader(br, &buf))
+	r = io.MultiReader(&buf, br)
+	if err != nil || ic.Width < 8*scaledSide || ic.Height < 8*scaledSide {
+		return cfg.decoder(r)
+	}
+	img, err := scaledjpeg.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	// same transforms imaging.AutoOrientation applies
+	switch exifOrientation(head) {
+	case 2:
+		img = imaging.FlipH(img)
+	case 3:
+		img = imaging.Rotate180(img)
+	case 4:
+		img = imaging.FlipV(img)
+	case 5:
+		img = imaging.Transpose(img)
+	case 6:
+		img = imaging.Rotate270(img)
+	case 7:
+		img = imaging.Transverse(img)
+	case 8:
+		img = imaging.Rotate90(img)
+	}
+	return img, nil
+}
@@ -0,0 +1,384 @@
+package similar
+
+import (
+	"context"
+	"errors"
+	"image"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Scanner finds similar images in a directory tree.
+type Scanner struct {
+	cfg *config
+
+	mu     sync.Mutex          // guards fields below and cfg.index
+	frames map[string]struct{} // names of index entries which are video frames
+	raw    Index               // raw hashes, see WithRawOrientation
+	own    map[string]uint64   // usual hashes of images in raw, by name
+	tiles  *tileIndex          // see WithTiles
+
+	pauseMu sync.Mutex
+	resumed chan struct{} // non-nil while paused, closed on resume
+
+	stamps map[string]fileStamp // files seen by Watch, only used by walk
+}
+
+// NewScanner returns Scanner configured with given options.
+func NewScanner(opts ...Option) *Scanner {
+	cfg := newConfig(opts)
+	if cfg.index == nil {
+		cfg.index = NewIndex()
+	}
+	cfg.stats = &counters{workers: make([]stageCounters, max(cfg.workers, cfg.autoWorkers))}
+	s := &Scanner{cfg: cfg, frames: make(map[string]struct{})}
+	if cfg.rawOrientation {
+		s.raw, s.own = NewIndex(), make(map[string]uint64)
+	}
+	if cfg.tileGrid > 0 {
+		s.tiles = &tileIndex{}
+	}
+	return s
+}
+
+// Pair describes a newly scanned image and a similar image already known to
+// the Scanner.
+type Pair struct {
+	Entry
+	Match Match
+
+	// RawOrientation is the name of one of the images, which EXIF
+	// orientation was ignored to find this match, see WithRawOrientation.
+	// Empty for usual matches.
+	RawOrientation string
+	// Transform describes how the newly scanned image was transformed to
+	// match, like "rotated 90° clockwise" or "mirrored", see WithInvariant.
+	// Empty for usual matches.
+	Transform string
+	// MatchedHash is, for matches with RawOrientation or Transform set, the
+	// hash compared in place of hash of that image: its raw hash, or hash of
+	// the transformed newly scanned image. Match.Distance is then the
+	// distance between it and hash of the other image. Hashes of Entry and
+	// Match are always the usual hashes of images.
+	MatchedHash uint64
+	// Tiles is the number of tiles of the newly scanned image matching tiles
+	// of Match, see WithTiles. Match.Distance is then the distance between
+	// hashes of whole images, which may be above threshold. Zero for usual
+	// matches.
+	Tiles int
+}
+
+// Scan walks dir looking for images (and videos, see WithVideoFrames),
+// skipping excluded paths (see WithExclude, WithMaxDepth and IgnoreFile),
+// and calls fn for each image that is within threshold distance of some
+// previously seen image. Calls to fn are serialized. Scan stops on the first
+// error it encounters, unless WithErrorHandler is set.
+func (s *Scanner) Scan(ctx context.Context, dir string, fn func(Pair)) error {
+	group, ctx := errgroup.WithContext(ctx)
+	workers := s.cfg.workers
+	if s.cfg.autoWorkers > 0 {
+		workers = s.cfg.autoWorkers
+	}
+	lookahead := s.cfg.lookahead
+	if lookahead < 0 {
+		lookahead = 2 * workers
+	}
+	ch := make(chan fileInfo, lookahead)
+	queue := ch // where walk sends files to
+	if s.cfg.spillDir != "" {
+		in := make(chan fileInfo)
+		group.Go(func() error { return spill(ctx, s.cfg.spillDir, in, ch) })
+		queue = in
+	}
+	discovered := func(p string, info os.FileInfo) bool {
+		if s.unchanged(p, fileStamp{size: info.Size(), mtime: info.ModTime().UnixNano()}) {
+			return false
+		}
+		atomic.AddInt64(&s.cfg.stats.discovered, 1)
+		return true
+	}
+	enqueue := func(p string, info os.FileInfo) error {
+		fi := fileInfo{name: p, info: info, video: s.cfg.videoInterval > 0 && IsVideo(p)}
+		select {
+		case queue <- fi:
+			return nil
+		default:
+		}
+		defer since(&s.cfg.stats.walkStall, time.Now())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case queue <- fi:
+		}
+		return nil
+	}
+	group.Go(func() error {
+		defer close(queue)
+		defer atomic.StoreInt32(&s.cfg.stats.walkDone, 1)
+		defer since(&s.cfg.stats.walk, time.Now())
+		if s.cfg.order == OrderWalk {
+			return s.cfg.walkFiles(ctx, dir, s.fileError, func(p string, info os.FileInfo) error {
+				if !discovered(p, info) {
+					return nil
+				}
+				return enqueue(p, info)
+			})
+		}
+		var items []walkItem
+		err := s.cfg.walkFiles(ctx, dir, s.fileError, func(p string, info os.FileInfo) error {
+			if discovered(p, info) {
+				items = append(items, walkItem{name: p, info: info})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		atomic.StoreInt32(&s.cfg.stats.walkDone, 1)
+		sortItems(items, s.cfg.order)
+		for _, it := range items {
+			if err := enqueue(it.name, it.info); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var lim *limiter
+	if s.cfg.autoWorkers > 0 {
+		start := DefaultWorkers()
+		if start > workers {
+			start = workers
+		}
+		lim = newLimiter(start)
+		actx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go autoscale(actx, lim, &s.cfg.stats.files, start, workers)
+	}
+	for i := 0; i < workers; i++ {
+		// copy of configuration with this worker's stage counters
+		cfg := *s.cfg
+		cfg.stage = &s.cfg.stats.workers[i]
+		group.Go(func() error {
+			for {
+				start := time.Now()
+				fi, ok := <-ch
+				since(&s.cfg.stats.workerStall, start)
+				if !ok {
+					return nil
+				}
+				if err := s.waitResumed(ctx); err != nil {
+					return err
+				}
+				if lim != nil {
+					lim.acquire()
+				}
+				err := s.scan(ctx, &cfg, fi, fn)
+				if lim != nil {
+					lim.release()
+				}
+				if err != nil {
+					return err
+				}
+			}
+		})
+	}
+	return group.Wait()
+}
+
+type fileInfo struct {
+	name  string
+	info  os.FileInfo
+	video bool
+}
+
+// scan processes a file with cfg of a worker, see Stages, which is
+// otherwise the same as s.cfg
+func (s *Scanner) scan(ctx context.Context, cfg *config, fi fileInfo, fn func(Pair)) error {
+	defer atomic.AddInt64(&s.cfg.stats.scanned, 1)
+	if s.cfg.settle > 0 {
+		if err := s.settle(ctx, &fi); err != nil {
+			return s.fileError(fi.name, err)
+		}
+	}
+	if fi.video {
+		return s.scanVideo(ctx, fi, fn)
+	}
+	failures := s.cfg.failures
+	if failures != nil && failures.Failed(fi.name, fi.info.Size(), fi.info.ModTime()) {
+		atomic.AddInt64(&s.cfg.stats.errors, 1)
+		return nil
+	}
+	var img image.Image // decoded image, if extra hashes are needed
+	var orientation int
+	if s.raw != nil || s.cfg.invariant || s.tiles != nil {
+		fcfg := *cfg
+		fcfg.decoded = func(i image.Image, o int) { img, orientation = i, o }
+		cfg = &fcfg
+	}
+	e, put, err := s.entry(cfg, fi)
+	if err != nil {
+		var derr *DecodeError
+		if failures != nil && errors.As(err, &derr) {
+			if err := failures.PutFailed(fi.name, fi.info.Size(), fi.info.ModTime(), err); err != nil {
+				return err
+			}
+		}
+		return s.fileError(fi.name, err)
+	}
+	if put {
+		if err := s.cfg.cache.Put(fi.name, fi.info.Size(), fi.info.ModTime(), e.Hash); err != nil {
+			return err
+		}
+	}
+	if cfg.decoded != nil && img == nil {
+		// hash was cached; if image doesn't decode now, extra hashes
+		// are skipped
+		cfg.hashFile(fi.name)
+	}
+	var raw *Entry
+	var transformed [8]uint64
+	var tiles []uint64
+	invariant, tiled := false, false
+	if img != nil {
+		cfg.timeHash(func() {
+			if s.raw != nil {
+				if hash, ok := cfg.rawHash(img, orientation); ok {
+					raw = &Entry{Name: e.Name, Hash: hash, Checksum: e.Checksum}
+				}
+			}
+			if cfg.invariant {
+				transformed, invariant = cfg.invariantHashes(img)
+			}
+			if s.tiles != nil {
+				tiles, tiled = cfg.tileHashes(img)
+			}
+		})
+	}
+	defer since(&cfg.stage.index, time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched map[string]struct{}
+	if s.raw != nil || invariant || tiled {
+		// earlier versions of e, see Watch
+		matched = map[string]struct{}{e.Name: {}}
+	}
+	for _, m := range s.cfg.index.Search(e.Hash, s.cfg.threshold) {
+		if m.Name == e.Name {
+			continue // earlier version, see Watch
+		}
+		if matched != nil {
+			matched[m.Name] = struct{}{}
+		}
+		fn(Pair{Entry: e, Match: m})
+	}
+	if s.raw != nil {
+		s.matchRaw(e, raw, matched, fn)
+	}
+	if invariant {
+		s.matchTransformed(e, transformed, matched, fn)
+	}
+	if tiled {
+		s.matchTiles(e, tiles, matched, fn)
+	}
+	s.cfg.index.Add(e)
+	return nil
+}
+
+// matchTransformed reports matches of hashes of transformed e, see
+// invariantHashes, with hashes of already seen images, skipping images
+// already matched. Each image is reported once, for the transform with the
+// smallest distance. It must be called with s.mu held.
+func (s *Scanner) matchTransformed(e Entry, hashes [8]uint64, matched map[string]struct{}, fn func(Pair)) {
+	var names []string
+	best := make(map[string]Pair)
+	for t := 1; t < len(hashes); t++ {
+		for _, m := range s.cfg.index.Search(hashes[t], s.cfg.threshold) {
+			if _, ok := matched[m.Name]; ok {
+				continue
+			}
+			p, ok := best[m.Name]
+			if !ok {
+				names = append(names, m.Name)
+			} else if p.Match.Distance <= m.Distance {
+				continue
+			}
+			best[m.Name] = Pair{Entry: e, Match: m, Transform: transforms[t], MatchedHash: hashes[t]}
+		}
+	}
+	for _, name := range names {
+		matched[name] = struct{}{}
+		fn(best[name])
+	}
+}
+
+// matchRaw reports matches of e with raw hashes of already seen images, and
+// of raw, a raw hash of e if it has one, with hashes of already seen images,
+// skipping images already matched. It must be called with s.mu held.
+func (s *Scanner) matchRaw(e Entry, raw *Entry, matched map[string]struct{}, fn func(Pair)) {
+	report := func(p Pair) {
+		if _, ok := matched[p.Match.Name]; ok {
+			return
+		}
+		matched[p.Match.Name] = struct{}{}
+		fn(p)
+	}
+	for _, m := range s.raw.Search(e.Hash, s.cfg.threshold) {
+		rawHash := m.Hash
+		m.Hash = s.own[m.Name]
+		report(Pair{Entry: e, Match: m, RawOrientation: m.Name, MatchedHash: rawHash})
+	}
+	if raw == nil {
+		return
+	}
+	for _, m := range s.cfg.index.Search(raw.Hash, s.cfg.threshold) {
+		report(Pair{Entry: e, Match: m, RawOrientation: e.Name, MatchedHash: raw.Hash})
+	}
+	s.raw.Add(*raw)
+	s.own[e.Name] = e.Hash
+}
+
+// entry hashes file with cfg, using cache if configured. It reports whether
+// the hash should be stored in cache.
+func (s *Scanner) entry(cfg *config, fi fileInfo) (e Entry, put bool, err error) {
+	e = Entry{Name: fi.name}
+	cache := cfg.cache
+	if cache != nil {
+		var ok bool
+		if e.Hash, ok = cache.Get(fi.name, fi.info.Size(), fi.info.ModTime()); ok {
+			if cfg.checksum != nil {
+				e.Checksum, err = cfg.checksumFile(fi.name)
+			}
+			return e, false, err
+		}
+	}
+	if cfg.salvage {
+		e.Hash, e.Salvaged, e.Checksum, err = cfg.hashFileSalvage(fi.name)
+	} else {
+		e.Hash, e.Checksum, err = cfg.hashFileChecksum(fi.name)
+	}
+	return e, err == nil && !e.Salvaged && cache != nil, err
+}
+
+func (s *Scanner) scanVideo(ctx context.Context, fi fileInfo, fn func(Pair)) error {
+	frames, err := s.cfg.hashVideo(ctx, fi.name, s.cfg.videoInterval)
+	if err != nil {
+		return s.fileError(fi.name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, frame := range frames {
+		e := Entry{Name: FrameName(fi.name, frame.Offset), Hash: frame.Hash}
+		for _, m := range s.cfg.index.Search(e.Hash, s.cfg.threshold) {
+			if _, ok := s.frames[m.Name]; !ok {
+				fn(Pair{Entry: e, Match: m})
+			}
+		}
+		s.frames[e.Name] = struct{}{}
+		s.cfg.index.Add(e)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package similar
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WithSettleTime makes Scanner wait until file has not been modified for at
+// least d before hashing it, re-checking its size and modification time.
+// This avoids hashing files still being written, which is useful when
+// scanning directories files are being uploaded to.
+func WithSettleTime(d time.Duration) Option { return func(c *config) { c.settle = d } }
+
+// settle blocks until file described by fi has not changed for at least
+// s.cfg.settle time, and updates fi with the latest file information.
+func (s *Scanner) settle(ctx context.Context, fi *fileInfo) error {
+	for {
+		age := time.Since(fi.info.ModTime())
+		if age >= s.cfg.settle {
+			return nil
+		}
+		timer := time.NewTimer(s.cfg.settle - age)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		info, err := os.Lstat(fi.name)
+		if err != nil {
+			return err
+		}
+		fi.info = info
+	}
+}
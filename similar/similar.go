@@ -0,0 +1,150 @@
+// Package similar implements perceptual hash based detection of similar
+// images on top of github.com/artyom/phash.
+package similar
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/artyom/phash"
+	"github.com/disintegration/imaging"
+)
+
+// HashReader decodes image from r and returns its perceptual hash. By default
+// image format is detected from the content, any format registered with the
+// image package is supported. EXIF orientation of JPEG images is honored.
+func HashReader(r io.Reader, opts ...Option) (uint64, error) {
+	return newConfig(opts).hashReader(r)
+}
+
+// HashBytes is like HashReader, but takes image from a byte slice.
+func HashBytes(b []byte, opts ...Option) (uint64, error) {
+	return HashReader(bytes.NewReader(b), opts...)
+}
+
+// HashFile is like HashReader, but reads image from a named file.
+func HashFile(name string, opts ...Option) (uint64, error) {
+	return newConfig(opts).hashFile(name)
+}
+
+// HashImage returns perceptual hash of an already decoded image.
+func HashImage(img image.Image, opts ...Option) (uint64, error) {
+	return newConfig(opts).hashImage(img)
+}
+
+func (cfg *config) hashFile(name string) (uint64, error) {
+	f, err := cfg.open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if cfg.mmap {
+		if data, unmap, ok := mapFile(f); ok {
+			defer unmap()
+			var hash uint64
+			err := withFaults(func() (err error) {
+				hash, err = cfg.hashReader(bytes.NewReader(data))
+				return err
+			})
+			return hash, err
+		}
+	}
+	return cfg.hashReader(f)
+}
+
+// open opens named file, adding time it takes to Open stage of worker
+func (cfg *config) open(name string) (*os.File, error) {
+	if cfg.stage != nil {
+		defer since(&cfg.stage.open, time.Now())
+	}
+	return os.Open(name)
+}
+
+func (cfg *config) hashReader(r io.Reader) (uint64, error) {
+	var start time.Time
+	if cfg.stage != nil {
+		start = time.Now()
+	}
+	r, err := guardTIFF(r)
+	if err != nil {
+		return 0, &DecodeError{Err: err}
+	}
+	if cfg.maxPixels > 0 {
+		if r, err = cfg.checkSize(r); err != nil {
+			return 0, err
+		}
+	}
+	var orientation int
+	if cfg.decoded != nil && cfg.rawOrientation {
+		br := bufio.NewReaderSize(r, exifHead)
+		head, _ := br.Peek(exifHead)
+		orientation, r = exifOrientation(head), br
+	}
+	img, err := cfg.decode(r)
+	if err != nil {
+		return 0, &DecodeError{Err: err}
+	}
+	if cfg.decoded != nil {
+		cfg.decoded(img, orientation)
+	}
+	if cfg.stage == nil {
+		return cfg.hashImage(img)
+	}
+	since(&cfg.stage.decode, start)
+	atomic.AddInt64(&cfg.stats.files, 1)
+	atomic.AddInt64(&cfg.stage.files, 1)
+	var hash uint64
+	cfg.timeHash(func() { hash, err = cfg.hashImage(img) })
+	return hash, err
+}
+
+// timeHash calls fn, adding time it takes, other than time spent scaling, to
+// Hash stage of worker
+func (cfg *config) timeHash(fn func()) {
+	if cfg.stage == nil {
+		fn()
+		return
+	}
+	// only this worker updates its counters, so time spent scaling is
+	// what its resize counter grows by
+	start, resized := time.Now(), atomic.LoadInt64(&cfg.stage.resize)
+	fn()
+	atomic.AddInt64(&cfg.stage.hash, int64(time.Since(start))-(atomic.LoadInt64(&cfg.stage.resize)-resized))
+}
+
+// errEmpty is returned for images of no pixels, which can't be scaled
+var errEmpty = errors.New("image is empty")
+
+func (cfg *config) hashImage(img image.Image) (uint64, error) {
+	if img.Bounds().Empty() {
+		return 0, errEmpty
+	}
+	if cfg.crop != nil {
+		var err error
+		if img, err = cfg.cropImage(img); err != nil {
+			return 0, err
+		}
+	}
+	if cfg.algo != PHash {
+		return cfg.hashOther(img)
+	}
+	return phash.Get(cfg.preprocess(img), cfg.resize)
+}
+
+func scale(img image.Image, w, h int) image.Image {
+	return imaging.Resize(img, w, h, imaging.Lanczos)
+}
+
+// resize is like scale, but adds time it takes to Resize stage of worker
+func (cfg *config) resize(img image.Image, w, h int) image.Image {
+	if cfg.stage != nil {
+		defer since(&cfg.stage.resize, time.Now())
+	}
+	return scale(img, w, h)
+}
@@ -0,0 +1,137 @@
+package similar
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WithSpillDir makes Scanner keep discovered files in a temporary file in dir
+// once its queue (see WithLookahead) is full, instead of pausing directory
+// walk. This lets walk of a huge tree finish early, at the cost of disk
+// space for names of files waiting to be processed.
+func WithSpillDir(dir string) Option {
+	return func(c *config) { c.spillDir = dir }
+}
+
+// spill moves files from in to out, writing them to a temporary file when
+// out is full, and reading them back in the same order once out has space.
+// It closes out when in is closed and all spilled files are sent. Files
+// which disappear while spilled are skipped.
+func spill(ctx context.Context, dir string, in <-chan fileInfo, out chan<- fileInfo) error {
+	defer close(out)
+	wf, err := os.CreateTemp(dir, "similar-spill-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(wf.Name())
+	defer wf.Close()
+	rf, err := os.Open(wf.Name())
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+	w, r := bufio.NewWriter(wf), bufio.NewReader(rf)
+	var written, read int // number of files spilled and read back
+	var head *fileInfo    // next file to send
+	for {
+		if head == nil && read < written {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			fi, err := readSpilled(r)
+			if err != nil {
+				return err
+			}
+			read++
+			if read == written {
+				// spill file is drained, start over
+				if err := wf.Truncate(0); err != nil {
+					return err
+				}
+				if _, err := wf.Seek(0, 0); err != nil {
+					return err
+				}
+				if _, err := rf.Seek(0, 0); err != nil {
+					return err
+				}
+				read, written = 0, 0
+				r.Reset(rf)
+			}
+			if fi == nil {
+				continue
+			}
+			head = fi
+		}
+		if head == nil && in == nil {
+			return nil
+		}
+		var send chan<- fileInfo
+		var next fileInfo
+		if head != nil {
+			// prefer sending over spilling, so that files only go to disk
+			// when out is full
+			select {
+			case out <- *head:
+				head = nil
+				continue
+			default:
+			}
+			send, next = out, *head
+		}
+		var fi fileInfo
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case send <- next:
+			head = nil
+			continue
+		case fi, ok = <-in:
+		}
+		if !ok {
+			in = nil
+			continue
+		}
+		if head == nil && read == written {
+			head = &fi
+			continue
+		}
+		video := "0"
+		if fi.video {
+			video = "1"
+		}
+		if _, err := w.WriteString(video + strconv.Quote(fi.name) + "\n"); err != nil {
+			return err
+		}
+		written++
+	}
+}
+
+// readSpilled reads next file from spill file. It returns nil fileInfo if
+// file no longer exists.
+func readSpilled(r *bufio.Reader) (*fileInfo, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	if len(line) < 2 {
+		return nil, fmt.Errorf("malformed spill file line %q", line)
+	}
+	name, err := strconv.Unquote(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: name, info: info, video: line[0] == '1'}, nil
+}
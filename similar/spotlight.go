@@ -0,0 +1,72 @@
+package similar
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// WithSpotlight makes Scanner ask macOS Spotlight index for images under the
+// scanned directory instead of walking it, which is much faster on large
+// trees. It uses mdfind program, which should be available in PATH. Files
+// Spotlight doesn't index, like those in hidden directories, are not
+// scanned. Found paths are absolute. WithExclude and WithMaxDepth apply, but
+// IgnoreFile files are not honored.
+func WithSpotlight() Option { return func(c *config) { c.spotlight = true } }
+
+// spotlightWalk calls fn for each file mdfind lists as an image (and, with
+// videos, a movie) under dir, in the order mdfind returns them
+func spotlightWalk(ctx context.Context, dir string, videos bool, fn filepath.WalkFunc) error {
+	query := "kMDItemContentTypeTree == 'public.image'"
+	if videos {
+		query += " || kMDItemContentTypeTree == 'public.movie'"
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "mdfind", "-0", "-onlyin", dir, query)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	rd := bufio.NewReader(stdout)
+	for {
+		p, err := rd.ReadString(0)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cancel()
+			cmd.Wait()
+			return err
+		}
+		p = strings.TrimSuffix(p, "\x00")
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			continue // index is behind file system
+		}
+		if err := fn(p, info, err); err != nil {
+			cancel()
+			cmd.Wait()
+			return err
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("mdfind: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
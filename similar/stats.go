@@ -0,0 +1,104 @@
+package similar
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds Scanner counters. Durations are summed over all workers, so
+// they may exceed the wall clock time of a scan.
+type Stats struct {
+	Discovered int64         // number of files directory walk found so far
+	Scanned    int64         // number of files processed, including cached and failed ones
+	Errors     int64         // number of files that failed, or were skipped as known failures
+	WalkDone   bool          // whether directory walk is complete, so Discovered is final
+	Files      int64         // number of images decoded and hashed
+	DecodeTime time.Duration // time spent reading and decoding images
+	HashTime   time.Duration // time spent scaling and hashing decoded images
+
+	WalkTime    time.Duration // time directory walk took, including WalkStall
+	WalkStall   time.Duration // time directory walk waited for space in queue
+	WorkerStall time.Duration // time workers waited for files to process
+
+	Stages  Stages   // time spent in each stage, summed over workers
+	Workers []Stages // time spent in each stage by each worker
+}
+
+// Stages holds time spent processing images, by stage.
+type Stages struct {
+	Files  int64         // number of images decoded and hashed
+	Open   time.Duration // opening files, and reading them with WithSalvage
+	Decode time.Duration // reading and decoding images
+	Resize time.Duration // scaling decoded images down for hashing
+	Hash   time.Duration // hashing scaled images
+	Index  time.Duration // matching and adding hashes to index, including waiting for other workers and calls of Scan callback
+}
+
+// Stats returns counters accumulated by Scanner so far. It is safe to call
+// while scan is in progress.
+func (s *Scanner) Stats() Stats {
+	c := s.cfg.stats
+	var total Stages
+	workers := make([]Stages, len(c.workers))
+	for i := range c.workers {
+		w := &c.workers[i]
+		workers[i] = Stages{
+			Files:  atomic.LoadInt64(&w.files),
+			Open:   time.Duration(atomic.LoadInt64(&w.open)),
+			Decode: time.Duration(atomic.LoadInt64(&w.decode)),
+			Resize: time.Duration(atomic.LoadInt64(&w.resize)),
+			Hash:   time.Duration(atomic.LoadInt64(&w.hash)),
+			Index:  time.Duration(atomic.LoadInt64(&w.index)),
+		}
+		total.Files += workers[i].Files
+		total.Open += workers[i].Open
+		total.Decode += workers[i].Decode
+		total.Resize += workers[i].Resize
+		total.Hash += workers[i].Hash
+		total.Index += workers[i].Index
+	}
+	return Stats{
+		Discovered: atomic.LoadInt64(&c.discovered),
+		Scanned:    atomic.LoadInt64(&c.scanned),
+		Errors:     atomic.LoadInt64(&c.errors),
+		WalkDone:   atomic.LoadInt32(&c.walkDone) != 0,
+		Files:      atomic.LoadInt64(&c.files),
+		DecodeTime: total.Decode,
+		HashTime:   total.Resize + total.Hash,
+
+		WalkTime:    time.Duration(atomic.LoadInt64(&c.walk)),
+		WalkStall:   time.Duration(atomic.LoadInt64(&c.walkStall)),
+		WorkerStall: time.Duration(atomic.LoadInt64(&c.workerStall)),
+
+		Stages:  total,
+		Workers: workers,
+	}
+}
+
+type counters struct {
+	discovered int64
+	scanned    int64
+	errors     int64
+	walkDone   int32
+
+	files int64
+
+	walk        int64 // nanoseconds
+	walkStall   int64 // nanoseconds
+	workerStall int64 // nanoseconds
+
+	workers []stageCounters // fixed when Scanner is created
+}
+
+// stageCounters are nanoseconds a worker spent in each stage, see Stages
+type stageCounters struct {
+	files  int64
+	open   int64
+	decode int64
+	resize int64
+	hash   int64
+	index  int64
+}
+
+// since adds time passed since t to counter v
+func since(v *int64, t time.Time) { atomic.AddInt64(v, int64(time.Since(t))) }
@@ -0,0 +1,109 @@
+package similar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// guardTIFF returns reader with the same data as r. If r holds a TIFF image,
+// it reads it whole, as TIFF decoder does anyway, and checks that offsets in
+// its first IFD are within the image: decoder grows its buffer up to any
+// offset it reads at, and allocates memory for entry data as large as the
+// entry says before reading it, so a file of a few hundred bytes could
+// otherwise make it allocate gigabytes.
+func guardTIFF(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, 16)
+	magic, _ := br.Peek(4)
+	if string(magic) != "II*\x00" && string(magic) != "MM\x00*" {
+		return br, nil
+	}
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	if !tiffBounded(data) {
+		return nil, errors.New("tiff: offset out of bounds")
+	}
+	return bytes.NewReader(data), nil
+}
+
+// TIFF tags of image data offsets and sizes
+const (
+	tagStripOffsets    = 273
+	tagStripByteCounts = 279
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+)
+
+// tiffBounded reports whether the first IFD of TIFF image in b, data of its
+// entries, and image data blocks it points to are within b.
+func tiffBounded(b []byte) bool {
+	if len(b) < 8 {
+		return false
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if b[0] == 'M' {
+		order = binary.BigEndian
+	}
+	size := int64(len(b))
+	off := int64(order.Uint32(b[4:]))
+	if off+2 > size || off+2+12*int64(order.Uint16(b[off:])) > size {
+		return false
+	}
+	ifd := b[off+2 : off+2+12*int64(order.Uint16(b[off:]))]
+	// sizes of data types decoder supports: byte, ascii, short, long and
+	// rational
+	sizes := [...]int64{0, 1, 1, 2, 4, 8}
+	var offsets, counts [2][]int64 // of strips and tiles
+	for ; len(ifd) >= 12; ifd = ifd[12:] {
+		tag, typ := order.Uint16(ifd), int(order.Uint16(ifd[2:]))
+		if typ <= 0 || typ >= len(sizes) {
+			continue // decoder doesn't read other types
+		}
+		n := int64(order.Uint32(ifd[4:]))
+		data := ifd[8:12]
+		if n*sizes[typ] > 4 {
+			val := int64(order.Uint32(ifd[8:]))
+			if val+n*sizes[typ] > size {
+				return false
+			}
+			data = b[val : val+n*sizes[typ]]
+		}
+		var dst *[]int64
+		switch tag {
+		case tagStripOffsets:
+			dst = &offsets[0]
+		case tagStripByteCounts:
+			dst = &counts[0]
+		case tagTileOffsets:
+			dst = &offsets[1]
+		case tagTileByteCounts:
+			dst = &counts[1]
+		default:
+			continue
+		}
+		for i := int64(0); i < n; i++ {
+			switch typ {
+			case 3: // short
+				*dst = append(*dst, int64(order.Uint16(data[2*i:])))
+			case 4: // long
+				*dst = append(*dst, int64(order.Uint32(data[4*i:])))
+			}
+		}
+	}
+	for k := range offsets {
+		for i, o := range offsets[k] {
+			var n int64
+			if i < len(counts[k]) {
+				n = counts[k][i]
+			}
+			if o+n > size {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package similar
+
+import (
+	"image"
+	"math"
+
+	"github.com/artyom/phash"
+	"github.com/artyom/phash-examples/similar/internal/bktree"
+	"github.com/disintegration/imaging"
+)
+
+// WithTiles makes Scanner also match partially edited images: each scanned
+// image is additionally split into grid×grid tiles, each tile twice as wide
+// and as tall as the grid step, so that adjacent tiles overlap by half.
+// Tiles are hashed separately, and image is matched with an already seen one
+// if at least votes fraction of its tiles are within threshold distance of
+// some tiles of that image. Such matches have Pair.Tiles set. Tile hashes are
+// computed from the same decoded image as the usual one, but are not cached,
+// so images are decoded even if their hashes are. Grid below 2 or votes
+// outside of (0, 1] range disable tiles.
+//
+// This finds images which parts were covered or replaced, like ones with
+// added captions or stickers. Tiles are placed relative to image bounds, so
+// they don't line up between an image and its crop, unless crop only trims a
+// few percent from the edges.
+func WithTiles(grid int, votes float64) Option {
+	return func(c *config) {
+		if grid < 2 || votes <= 0 || votes > 1 {
+			c.tileGrid = 0
+			return
+		}
+		c.tileGrid, c.tileVotes = grid, votes
+	}
+}
+
+// tileIndex keeps tile hashes of already seen images
+type tileIndex struct {
+	tree    bktree.Tree
+	owners  []int   // indexed by tile id, positions in entries
+	entries []Entry // images tiles belong to
+}
+
+// add adds tile hashes of e to the index
+func (x *tileIndex) add(e Entry, tiles []uint64) {
+	for _, h := range tiles {
+		x.tree.Add(h, len(x.owners))
+		x.owners = append(x.owners, len(x.entries))
+	}
+	x.entries = append(x.entries, e)
+}
+
+// tileHashes returns hashes of tiles of img, see WithTiles, row by row. It
+// returns false if image is too small to be split into tiles.
+func (cfg *config) tileHashes(img image.Image) ([]uint64, bool) {
+	if cfg.crop != nil {
+		var err error
+		if img, err = cfg.cropImage(img); err != nil {
+			return nil, false
+		}
+	}
+	n, b := cfg.tileGrid, img.Bounds()
+	dx, dy := b.Dx()/(n+1), b.Dy()/(n+1)
+	if dx < 8 || dy < 8 {
+		return nil, false
+	}
+	out := make([]uint64, 0, n*n)
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			min := b.Min.Add(image.Pt(x*dx, y*dy))
+			tile := imaging.Crop(img, image.Rectangle{Min: min, Max: min.Add(image.Pt(2*dx, 2*dy))})
+			var h uint64
+			var err error
+			if cfg.algo != PHash {
+				h, err = cfg.hashOther(tile)
+			} else {
+				h, err = phash.Get(cfg.preprocess(tile), cfg.resize)
+			}
+			if err != nil {
+				return nil, false
+			}
+			out = append(out, h)
+		}
+	}
+	return out, true
+}
+
+// matchTiles reports already seen images which tiles match at least
+// configured fraction of tiles of e, skipping images already matched, and
+// adds tiles of e to the index. It must be called with s.mu held.
+func (s *Scanner) matchTiles(e Entry, tiles []uint64, matched map[string]struct{}, fn func(Pair)) {
+	need := int(math.Ceil(s.cfg.tileVotes * float64(len(tiles))))
+	votes := make(map[int]int) // positions in s.tiles.entries to tiles matched
+	var order []int
+	for _, h := range tiles {
+		seen := make(map[int]bool) // each tile votes once per image
+		s.tiles.tree.Search(h, s.cfg.threshold, func(id, _ int) {
+			i := s.tiles.owners[id]
+			if seen[i] {
+				return
+			}
+			seen[i] = true
+			if votes[i] == 0 {
+				order = append(order, i)
+			}
+			votes[i]++
+		})
+	}
+	for _, i := range order {
+		m := s.tiles.entries[i]
+		if _, ok := matched[m.Name]; ok || votes[i] < need {
+			continue
+		}
+		matched[m.Name] = struct{}{}
+		fn(Pair{Entry: e, Match: Match{Entry: m, Distance: phash.Distance(e.Hash, m.Hash)}, Tiles: votes[i]})
+	}
+	s.tiles.add(e, tiles)
+}
@@ -0,0 +1,181 @@
+package similar
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artyom/phash"
+)
+
+// VideoFrame is a frame sampled from a video file.
+type VideoFrame struct {
+	Offset time.Duration // approximate position of the frame in the video
+	Hash   uint64
+}
+
+// HashVideo samples video file every interval and returns hashes of sampled
+// frames. It uses ffmpeg program to decode video, which should be available
+// in PATH.
+func HashVideo(ctx context.Context, name string, interval time.Duration, opts ...Option) ([]VideoFrame, error) {
+	return newConfig(opts).hashVideo(ctx, name, interval)
+}
+
+func (cfg *config) hashVideo(ctx context.Context, name string, interval time.Duration) ([]VideoFrame, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid frame sampling interval %v", interval)
+	}
+	filter := fmt.Sprintf("fps=1/%g", interval.Seconds())
+	if cfg.videoCrop > 0 {
+		filter += fmt.Sprintf(",crop=iw:ih*%g:0:0", 1-cfg.videoCrop)
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-nostdin", "-loglevel", "error", "-i", name,
+		"-vf", filter, "-f", "image2pipe", "-c:v", "png", "-")
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	frames, err := cfg.hashFrames(bufio.NewReader(stdout), interval)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("%s: ffmpeg: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return frames, nil
+}
+
+// hashFrames reads a stream of concatenated png images and hashes them.
+func (cfg *config) hashFrames(r *bufio.Reader, interval time.Duration) ([]VideoFrame, error) {
+	var out []VideoFrame
+	for {
+		if _, err := r.Peek(1); err == io.EOF {
+			return out, nil
+		}
+		img, err := png.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := cfg.hashImage(img)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, VideoFrame{Offset: time.Duration(len(out)) * interval, Hash: hash})
+	}
+}
+
+// WithVideoFrames makes Scanner also process video files, sampling a frame
+// every interval, so that images can be matched against videos they were
+// captured from. Frames are reported with names in a form of
+// "clip.mp4#t=0:01:23" (see FrameName), and are never matched against
+// other video frames. Decoding video requires ffmpeg program to be
+// available in PATH.
+func WithVideoFrames(interval time.Duration) Option {
+	return func(c *config) { c.videoInterval = interval }
+}
+
+// WithVideoCropBottom makes video frames cropped by a given fraction of their
+// height from the bottom before hashing, so burned-in subtitles don't affect
+// frame hashes. Values outside of [0, 1) range are ignored. Note that if
+// cropping is enabled, frames are only reliably matched against other frames
+// cropped the same way, and not against whole screenshots.
+func WithVideoCropBottom(fraction float64) Option {
+	return func(c *config) {
+		if fraction >= 0 && fraction < 1 {
+			c.videoCrop = fraction
+		}
+	}
+}
+
+// HashVideoFrames returns hashes of n frames evenly spaced over video file
+// duration, a signature which can be compared with FramesDistance to match
+// whole videos against each other. Fewer frames may be returned for very
+// short videos. It uses ffprobe and ffmpeg programs, which should be
+// available in PATH.
+func HashVideoFrames(ctx context.Context, name string, n int, opts ...Option) ([]uint64, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of frames %d", n)
+	}
+	duration, err := videoDuration(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	frames, err := newConfig(opts).hashVideo(ctx, name, duration/time.Duration(n))
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) > n {
+		frames = frames[:n]
+	}
+	out := make([]uint64, len(frames))
+	for i, f := range frames {
+		out[i] = f.Hash
+	}
+	return out, nil
+}
+
+// FramesDistance returns mean distance between hashes of corresponding
+// frames of two videos, as returned by HashVideoFrames. If videos have
+// different number of frames, extra frames are ignored. It returns 64 if
+// either has no frames.
+func FramesDistance(a, b []uint64) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) == 0 {
+		return 64
+	}
+	var sum int
+	for i := range a {
+		sum += phash.Distance(a[i], b[i])
+	}
+	return float64(sum) / float64(len(a))
+}
+
+// videoDuration returns video file duration using ffprobe
+func videoDuration(ctx context.Context, name string) (time.Duration, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", name)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("%s: ffprobe: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	secs, err := strconv.ParseFloat(string(bytes.TrimSpace(b)), 64)
+	if err != nil || secs <= 0 {
+		return 0, fmt.Errorf("%s: ffprobe: unexpected duration %q", name, bytes.TrimSpace(b))
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// FrameName returns name of a video frame at given offset as used by Scanner.
+func FrameName(name string, offset time.Duration) string {
+	s := int(offset / time.Second)
+	return fmt.Sprintf("%s#t=%d:%02d:%02d", name, s/3600, s/60%60, s%60)
+}
+
+// IsVideo reports whether file name has an extension of a video format which
+// Scanner samples with WithVideoFrames.
+func IsVideo(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp4", ".m4v", ".mov", ".mkv", ".webm", ".avi":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package similar
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Walk calls fn for each file under dir which Scanner configured with the
+// same options would process: images, and videos if WithVideoFrames is set,
+// skipping excluded paths. Directory is listed the same way Scanner does it,
+// see WithDeterministic, WithBulkStat, WithSpotlight and WithFileList. Walk
+// stops on the first error, either of fn or of listing directories, unless
+// WithErrorHandler is set: errors of paths below dir are then passed to it.
+func Walk(ctx context.Context, dir string, fn func(name string, info os.FileInfo) error, opts ...Option) error {
+	cfg := newConfig(opts)
+	onErr := func(name string, err error) error {
+		if cfg.onError == nil {
+			return err
+		}
+		cfg.onError(name, err)
+		return nil
+	}
+	return cfg.walkFiles(ctx, dir, onErr, fn)
+}
+
+// walkFiles implements Walk, passing errors of paths below dir to onErr,
+// which may return nil to continue walk
+func (cfg *config) walkFiles(ctx context.Context, dir string, onErr func(name string, err error) error,
+	fn func(name string, info os.FileInfo) error) error {
+	var x *excluder // nil with file list
+	if cfg.fileList == nil {
+		x = newExcluder(dir, cfg)
+	}
+	walkFunc := func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			return onErr(p, err)
+		}
+		if x != nil && x.skip(p, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if !(cfg.videoInterval > 0 && IsVideo(p)) && !IsImage(p) && !(filepath.Ext(p) == "" && sniffImage(p)) {
+			return nil
+		}
+		return fn(p, info)
+	}
+	switch {
+	case cfg.fileList != nil:
+		return listWalk(ctx, cfg.fileList, walkFunc)
+	case cfg.spotlight:
+		return spotlightWalk(ctx, dir, cfg.videoInterval > 0, walkFunc)
+	case cfg.deterministic:
+		return filepath.Walk(dir, walkFunc)
+	case cfg.bulkStat:
+		return walkBulk(dir, cfg.mayBeImage, walkFunc)
+	}
+	return walk(dir, walkFunc)
+}
+
+// mayBeImage reports whether walk should get attributes of named file, as
+// it may be an image or a video Scanner processes
+func (cfg *config) mayBeImage(name string) bool {
+	return IsImage(name) || filepath.Ext(name) == "" || cfg.videoInterval > 0 && IsVideo(name)
+}
+
+// walkChunk is the number of directory entries walk reads at once
+const walkChunk = 256
+
+// walk is like filepath.Walk, but reads directories in chunks of walkChunk
+// entries instead of reading and sorting them whole. Memory it needs
+// depends on tree depth, but not on directory sizes. Directory entries are
+// visited in the order operating system returns them.
+func walk(root string, fn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(root, info, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walkDir(path string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	if err := fn(path, info, nil); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	defer f.Close()
+	for {
+		infos, err := f.Readdir(walkChunk)
+		for _, fi := range infos {
+			if err := walkDir(filepath.Join(path, fi.Name()), fi, fn); err != nil {
+				if !fi.IsDir() || err != filepath.SkipDir {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fn(path, info, err)
+		}
+	}
+}
+
+// statWorkers is the number of concurrent lstat calls walkBulk makes
+const statWorkers = 16
+
+// WithBulkStat makes Scanner list directories without getting attributes of
+// every entry, only getting them for files that may be images (or videos),
+// several at a time. This saves most of per-file round trips on network file
+// systems like NFS and SMB, where listing names and types is a single bulk
+// request, but each stat is a separate one. It is ignored with
+// WithDeterministic.
+func WithBulkStat() Option { return func(c *config) { c.bulkStat = true } }
+
+// walkBulk is like walk, but only calls fn for directories and for regular
+// files which names want reports true for, getting attributes of such files
+// of each directory chunk concurrently.
+func walkBulk(root string, want func(name string) bool, fn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else if !info.IsDir() {
+		err = fn(root, info, nil)
+	} else {
+		err = walkDirBulk(root, info, want, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walkDirBulk(path string, info os.FileInfo, want func(string) bool, fn filepath.WalkFunc) error {
+	if err := fn(path, info, nil); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	defer f.Close()
+	for {
+		entries, err := f.ReadDir(walkChunk)
+		var dirs, files []string
+		for _, d := range entries {
+			name := filepath.Join(path, d.Name())
+			switch {
+			case d.IsDir():
+				dirs = append(dirs, name)
+			case d.Type().IsRegular() && want(name):
+				files = append(files, name)
+			}
+		}
+		infos, errs := lstatAll(files)
+		for i, name := range files {
+			if err := fn(name, infos[i], errs[i]); err != nil {
+				return err
+			}
+		}
+		for _, name := range dirs {
+			fi, err := os.Lstat(name)
+			if err != nil {
+				err = fn(name, nil, err)
+			} else {
+				err = walkDirBulk(name, fi, want, fn)
+			}
+			if err != nil && err != filepath.SkipDir {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fn(path, info, err)
+		}
+	}
+}
+
+// lstatAll calls os.Lstat on names, up to statWorkers at a time
+func lstatAll(names []string) ([]os.FileInfo, []error) {
+	infos := make([]os.FileInfo, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, statWorkers)
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			infos[i], errs[i] = os.Lstat(name)
+			<-sem
+		}(i, name)
+	}
+	wg.Wait()
+	return infos, errs
+}
+
+// WithLookahead sets how many discovered files may wait in queue for
+// processing. Directory walk pauses once queue is full, so memory use stays
+// flat regardless of tree size. Default is two files per worker.
+func WithLookahead(n int) Option {
+	return func(c *config) {
+		if n >= 0 {
+			c.lookahead = n
+		}
+	}
+}
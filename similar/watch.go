@@ -0,0 +1,47 @@
+package similar
+
+import (
+	"context"
+	"time"
+)
+
+// Watch is like Scan, but after scanning dir it keeps scanning it again
+// every interval, until ctx is canceled, only processing files that are new
+// or changed since they were last seen. This finds duplicates of images as
+// they are added, as to an ingest folder. Directory is walked, so unchanged
+// files cost a stat each time. Changed files are not matched against their
+// own earlier versions, but other images may still match hashes of those,
+// as Index keeps them. Watch returns nil once ctx is canceled.
+func (s *Scanner) Watch(ctx context.Context, dir string, interval time.Duration, fn func(Pair)) error {
+	s.stamps = make(map[string]fileStamp)
+	defer func() { s.stamps = nil }()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		if err := s.Scan(ctx, dir, fn); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		timer.Reset(interval)
+	}
+}
+
+// unchanged reports whether file was already seen by Watch with the same
+// size and modification time, and records it as seen otherwise
+func (s *Scanner) unchanged(name string, st fileStamp) bool {
+	if s.stamps == nil {
+		return false
+	}
+	if old, ok := s.stamps[name]; ok && old == st {
+		return true
+	}
+	s.stamps[name] = st
+	return false
+}
@@ -0,0 +1,22 @@
+package similar
+
+import (
+	"runtime"
+	"sync"
+)
+
+// DefaultWorkers returns the default number of images processed
+// concurrently: runtime.GOMAXPROCS(0), but no more than CPU quota of the
+// cgroup of the process, rounded up, on Linux. Containers limited to a few
+// CPUs often see all CPUs of the host, so that many workers would only make
+// them throttled.
+func DefaultWorkers() int {
+	n := runtime.GOMAXPROCS(0)
+	if q := quotaCPUs(); q > 0 && q < n {
+		return q
+	}
+	return n
+}
+
+// quotaCPUs caches cpuQuota, as cgroup limits don't change while running
+var quotaCPUs = sync.OnceValue(cpuQuota)
@@ -0,0 +1,43 @@
+package similar
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cpuQuota returns CPU quota of cgroup of the process, as a number of CPUs
+// rounded up, or 0 if there's none. Both cgroup v2 and v1 are supported, as
+// mounted in containers, where cgroup of the process is the root one.
+func cpuQuota() int {
+	// cgroup v2: "max 100000" or "200000 100000"
+	if b, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		if f := strings.Fields(string(b)); len(f) == 2 {
+			return quotaCPUsOf(f[0], f[1])
+		}
+		return 0
+	}
+	quota, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	if err != nil {
+		return 0
+	}
+	period, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err != nil {
+		return 0
+	}
+	return quotaCPUsOf(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+// quotaCPUsOf returns quota over period rounded up, or 0 if quota is not a
+// positive number, like "max" or "-1" meaning no limit
+func quotaCPUsOf(quota, period string) int {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return int((q + p - 1) / p)
+}
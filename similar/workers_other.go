@@ -0,0 +1,6 @@
+//go:build !linux
+// +build !linux
+
+package similar
+
+func cpuQuota() int { return 0 }